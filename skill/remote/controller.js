@@ -10,51 +10,141 @@ $(document).ready(function() {
             robot.connectSkill({
                 skillID: skillID,
                 callback: robot.onRecvSkillData(function(skillID, data) {
-                    console.log("received data from robot: ")
-                    console.log(data)
-                    if (data.length > 100) {
-                        var img = $('<img id="dynamic" height="50px" width="50px" style="display:inline-block">'); //Equivalent: $(document.createElement('img'))
-                        img.attr('src', 'data:image/jpeg;base64,' + data);
-                        //var img = new Image();
-                        img.src = 'data:image/jpeg;base64,' + data;
-                        //ctx.drawImage(img, 0, 0);
-                        img.appendTo($('#imagediv'));
-                        document.getElementById('img').setAttribute('src', 'data:image/jpeg;base64,' + data);
+                    // every message is {v, type, time, payload}, see skill/robot/src/messages.go
+                    var message;
+                    try {
+                        message = JSON.parse(data);
+                    } catch (err) {
+                        console.error("could not parse message from robot: ", err, data);
+                        return;
+                    }
+                    if (message.v !== 1) {
+                        console.error("unsupported protocol version " + message.v);
+                        return;
+                    }
+                    var handler = messageHandlers[message.type];
+                    if (handler) {
+                        handler(message.payload, message);
                     } else {
-                        //grab string and parse rect x,y,h,w
-                        //draw on canvas
+                        console.log("unhandled message: ", message);
                     }
                 })
             });
-            document.getElementById("test").onclick = function() {
-                robot.sendData({
-                    skillID: skillID,
-                    data: "test"
-                })
-            }
-            document.getElementById("start").onclick = function() {
-                robot.sendData({
-                    skillID: skillID,
-                    data: "start"
-                })
-            }
-            document.getElementById("stop").onclick = function() {
-                robot.sendData({
-                    skillID: skillID,
-                    data: "stop"
-                })
-            }
-            document.getElementById("pic").onclick = function() {
+            var MAX_FRAMES = 50;
+            var frames = {};
+            var frameOrder = [];
+            var messageHandlers = {
+                image: function(frame) {
+                    var src = 'data:image/' + frame.format + ';base64,' + frame.data;
+                    var img = $('<img id="dynamic" height="50px" width="50px" style="display:inline-block">'); //Equivalent: $(document.createElement('img'))
+                    img.attr('src', src);
+                    img.attr('title', 'frame ' + frame.frameId + ' at ' + frame.direction.toFixed(0) + '\u00b0');
+                    if (frame.stream !== "preview") { // preview frames only go to the canvas, with their detections
+                        img.appendTo($('#imagediv'));
+                        document.getElementById('img').setAttribute('src', src); // the latest picture, e.g. from Take Picture
+                    }
+                    frames[frame.frameId] = { img: img[0], annotated: frame.annotated };
+                    frameOrder.push(frame.frameId);
+                    if (frameOrder.length > MAX_FRAMES) {
+                        delete frames[frameOrder.shift()];
+                    }
+                },
+                detections: function(overlay) {
+                    // the image for the frame is always sent first, annotated frames already have the boxes
+                    var frame = frames[overlay.frameId];
+                    if (!frame) {
+                        return;
+                    }
+                    var img = frame.img;
+                    var draw = function() {
+                        var scaleX = canvas.width / overlay.width;
+                        var scaleY = canvas.height / overlay.height;
+                        ctx.drawImage(img, 0, 0, canvas.width, canvas.height);
+                        ctx.strokeStyle = "#00ff00";
+                        ctx.lineWidth = 3;
+                        ctx.font = "20px sans-serif";
+                        ctx.fillStyle = "#00ff00";
+                        overlay.faces.forEach(function(face) {
+                            if (!frame.annotated) {
+                                ctx.strokeRect(face.x * scaleX, face.y * scaleY, face.width * scaleX, face.height * scaleY);
+                            }
+                            var label = (face.distance / 1000).toFixed(1) + "m";
+                            if (face.personId) {
+                                label = face.personId + " " + label;
+                            }
+                            ctx.fillText(label, face.x * scaleX, face.y * scaleY - 4);
+                        });
+                    };
+                    if (img.complete) {
+                        draw();
+                    } else {
+                        img.onload = draw;
+                    }
+                },
+                state: function(change) {
+                    console.log("state " + change.from + " -> " + change.to + " (" + change.reason + ")");
+                },
+                telemetry: function(telemetry) {
+                    console.log("telemetry: ", telemetry);
+                },
+                target: function(status) {
+                    // status of a "follow <personId>" search, notFound ends the follow
+                    console.log("target " + status.personId + ": " + status.status);
+                },
+                log: function(entry) {
+                    console.log("[robot " + entry.level + "] " + entry.text);
+                },
+                ack: function(reply) {
+                    if (!reply.ok) {
+                        console.error("command " + reply.command + " failed: " + reply.error);
+                    }
+                    var pending = pendingCommands[reply.id];
+                    if (pending) {
+                        clearTimeout(pending.timer);
+                        delete pendingCommands[reply.id];
+                        pending.callback(reply);
+                    }
+                }
+            };
+            var COMMAND_TIMEOUT_MS = 10000;
+            var nextCommandID = 1;
+            var pendingCommands = {};
+            // sendCommand wraps a command in the skill's envelope, the reply carries the same id.
+            // callback gets the ack, or a failed reply when none comes within COMMAND_TIMEOUT_MS
+            function sendCommand(command, args, callback) {
+                var id = String(nextCommandID++);
+                if (callback) {
+                    pendingCommands[id] = {
+                        callback: callback,
+                        timer: setTimeout(function() {
+                            delete pendingCommands[id];
+                            callback({ id: id, command: command, ok: false, error: "no reply" });
+                        }, COMMAND_TIMEOUT_MS)
+                    };
+                }
                 robot.sendData({
                     skillID: skillID,
-                    data: "pic"
+                    data: JSON.stringify({ id: id, command: command, args: args })
                 })
             }
+            window.sendCommand = sendCommand;
+            ["test", "start", "stop", "pic"].forEach(function(command) {
+                document.getElementById(command).onclick = function() {
+                    sendCommand(command);
+                }
+            });
             document.getElementById("lookaround").onclick = function() {
-                robot.sendData({
-                    skillID: skillID,
-                    data: "spinAround"
-                })
+                sendCommand("spinAround");
+            }
+            var previewing = false;
+            document.getElementById("preview").onclick = function() {
+                var button = this;
+                sendCommand(previewing ? "preview.stop" : "preview.start", null, function(reply) {
+                    if (reply.ok) {
+                        previewing = !previewing;
+                        button.textContent = previewing ? "Stop Preview" : "Preview";
+                    }
+                });
             }
         }
     });
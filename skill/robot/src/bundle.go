@@ -0,0 +1,325 @@
+package examples
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mind/core/framework/log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"shared/facerec"
+	"shared/fileutil"
+)
+
+/*====================================================
+MODEL BUNDLES
+The webserver publishes the recognizer, the cascade and the
+people the recognizer knows as one versioned bundle. The skill
+polls BundleURL/manifest, downloads BundleURL when the version
+changes and checks it against the manifest's sha256. An https
+BundleURL is trusted the way serverTls trusts the robot
+connection. A bundle
+is written into its own directory under BundleDir and then
+swapped in through SetConfig, which loads it completely before
+replacing anything, so a bad download or a bundle that does not
+load leaves the last good one running. BundleDir/current.json
+records the bundle in use, and is loaded again on start.
+=====================================================*/
+
+const DEFAULT_BUNDLE_URL = "http://10.0.0.85:8000/bundle"
+const BUNDLE_DIR = "assets/bundle"
+const BUNDLE_CHECK_SECONDS = 60
+const BUNDLE_DOWNLOAD_TIMEOUT = time.Second * 30
+const CURRENT_BUNDLE_FILE = "current.json"
+
+// BUNDLE_FETCH_ATTEMPTS is how often UpdateBundle reads the manifest again when the bundle changes under it.
+const BUNDLE_FETCH_ATTEMPTS = 3
+
+var errBundleChanged = errors.New("the webserver published another bundle while this one was downloading")
+
+func init() {
+	RegisterCommand("bundle", func(FS *FollowSkill, args json.RawMessage) (interface{}, error) {
+		return FS.Bundle(), nil
+	})
+	RegisterCommand("bundle.update", func(FS *FollowSkill, args json.RawMessage) (interface{}, error) {
+		if _, err := FS.UpdateBundle(); err != nil {
+			return nil, err
+		}
+		return FS.Bundle(), nil
+	})
+}
+
+/* InstalledBundle is a bundle written out under BundleDir, the files are what the config points at */
+type InstalledBundle struct {
+	Manifest       facerec.BundleManifest          `json:"manifest"`
+	CascadePath    string                          `json:"cascadePath"`
+	RecognizerPath string                          `json:"recognizerPath"`
+	People         map[string]facerec.BundlePerson `json:"people"`
+}
+
+type bundleState struct {
+	mu        sync.Mutex
+	installed *InstalledBundle
+	updateMu  sync.Mutex
+	stop      chan struct{}
+	stopOnce  sync.Once
+}
+
+// Bundle is the bundle in use, nil before the first one is installed.
+func (FS *FollowSkill) Bundle() *InstalledBundle {
+	FS.bundle.mu.Lock()
+	defer FS.bundle.mu.Unlock()
+	return FS.bundle.installed
+}
+
+// knownPerson looks a recognizer label up in the bundle in use.
+func (FS *FollowSkill) knownPerson(personID string) (facerec.BundlePerson, bool) {
+	installed := FS.Bundle()
+	if installed == nil {
+		return facerec.BundlePerson{}, false
+	}
+	person, ok := installed.People[personID]
+	return person, ok
+}
+
+// LoadInstalledBundle switches to the bundle recorded in BundleDir, if there is one.
+func (FS *FollowSkill) LoadInstalledBundle() error {
+	data, err := ioutil.ReadFile(filepath.Join(FS.Config().BundleDir, CURRENT_BUNDLE_FILE))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var installed InstalledBundle
+	if err := json.Unmarshal(data, &installed); err != nil {
+		return fmt.Errorf("%s: %v", CURRENT_BUNDLE_FILE, err)
+	}
+	return FS.useBundle(installed)
+}
+
+// useBundle points the config at an installed bundle's files, SetConfig loads them and swaps them in.
+func (FS *FollowSkill) useBundle(installed InstalledBundle) error {
+	err := FS.UpdateConfig(func(cfg Config) (Config, error) {
+		cfg.CascadePath = installed.CascadePath
+		cfg.RecognizerPath = installed.RecognizerPath
+		return cfg, nil
+	})
+	if err != nil {
+		return err
+	}
+	FS.bundle.mu.Lock()
+	FS.bundle.installed = &installed
+	FS.bundle.mu.Unlock()
+	return nil
+}
+
+/*
+UpdateBundle
+Description: installs the webserver's current bundle when its version differs
+from the one in use. It returns whether a new bundle was installed; on any
+error the bundle in use stays. A bundle republished between reading the
+manifest and downloading is noticed from the download's headers, and the
+manifest is read again.
+*/
+func (FS *FollowSkill) UpdateBundle() (bool, error) {
+	FS.bundle.updateMu.Lock()
+	defer FS.bundle.updateMu.Unlock()
+	cfg := FS.Config()
+	if cfg.BundleURL == "" {
+		return false, errors.New("no bundleUrl configured")
+	}
+	client, err := bundleClient(cfg)
+	if err != nil {
+		return false, err
+	}
+
+	var manifest facerec.BundleManifest
+	var data []byte
+	for attempt := 1; ; attempt++ {
+		if manifest, err = fetchManifest(client, cfg.BundleURL); err != nil {
+			return false, err
+		}
+		if current := FS.Bundle(); current != nil && current.Manifest.Version == manifest.Version && current.Manifest.SHA256 == manifest.SHA256 {
+			return false, nil
+		}
+		data, err = fetchBundle(client, cfg.BundleURL, manifest)
+		if err == errBundleChanged && attempt < BUNDLE_FETCH_ATTEMPTS {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		break
+	}
+	var bundle facerec.ModelBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return false, fmt.Errorf("bundle %d: %v", manifest.Version, err)
+	}
+	if err := bundle.Validate(); err != nil {
+		return false, fmt.Errorf("bundle %d: %v", manifest.Version, err)
+	}
+
+	installed, versionDir, err := installBundle(cfg.BundleDir, manifest, bundle)
+	if err != nil {
+		os.RemoveAll(versionDir)
+		return false, err
+	}
+	if err := FS.useBundle(installed); err != nil {
+		os.RemoveAll(versionDir)
+		return false, fmt.Errorf("bundle %d: %v", manifest.Version, err)
+	}
+	record, err := json.Marshal(installed)
+	if err == nil {
+		err = fileutil.WriteFileAtomic(filepath.Join(cfg.BundleDir, CURRENT_BUNDLE_FILE), record)
+	}
+	if err != nil {
+		// the previous bundle's files stay, it is the one that loads on restart
+		log.Error.Println("bundle ", manifest.Version, " is in use but could not be recorded: ", err)
+	} else {
+		removeOtherBundles(cfg.BundleDir, versionDir)
+	}
+	log.Info.Println("bundle ", manifest.Version, " installed")
+	return true, nil
+}
+
+// bundleClient trusts the webserver the way the robot connection does, for an https BundleURL.
+func bundleClient(cfg Config) (*http.Client, error) {
+	client := &http.Client{Timeout: BUNDLE_DOWNLOAD_TIMEOUT}
+	if cfg.ServerTLS.Enabled {
+		tlsConfig, err := cfg.ServerTLS.ClientConfig()
+		if err != nil {
+			return nil, err
+		}
+		client.Transport = &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig}
+	}
+	return client, nil
+}
+
+// fetchManifest reads the manifest at url/manifest and checks its sha256 before anything is downloaded.
+func fetchManifest(client *http.Client, url string) (facerec.BundleManifest, error) {
+	var manifest facerec.BundleManifest
+	resp, err := httpGet(client, url+"/manifest")
+	if err != nil {
+		return manifest, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return manifest, err
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, fmt.Errorf("bundle manifest: %v", err)
+	}
+	if sum, err := hex.DecodeString(manifest.SHA256); err != nil || len(sum) != sha256.Size {
+		return manifest, fmt.Errorf("bundle manifest has no valid sha256: %q", manifest.SHA256)
+	}
+	if manifest.Size <= 0 {
+		return manifest, fmt.Errorf("bundle manifest has no size: %d", manifest.Size)
+	}
+	return manifest, nil
+}
+
+// fetchBundle downloads the bundle at url, errBundleChanged when the webserver now serves another one than manifest.
+func fetchBundle(client *http.Client, url string, manifest facerec.BundleManifest) ([]byte, error) {
+	resp, err := httpGet(client, url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if etag := resp.Header.Get("ETag"); etag != "" && etag != `"`+manifest.SHA256+`"` {
+		return nil, errBundleChanged
+	}
+	if version := resp.Header.Get("X-Bundle-Version"); version != "" && version != strconv.FormatInt(manifest.Version, 10) {
+		return nil, errBundleChanged
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, int64(manifest.Size)+1))
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	if len(data) != manifest.Size || hex.EncodeToString(sum[:]) != manifest.SHA256 {
+		return nil, fmt.Errorf("bundle %d does not match its manifest, got %d bytes with sha256 %x", manifest.Version, len(data), sum)
+	}
+	return data, nil
+}
+
+// RunBundleUpdates checks for a new bundle every BundleCheckSeconds until CloseBundleUpdates, 0 pauses checking.
+func (FS *FollowSkill) RunBundleUpdates() {
+	for {
+		cfg := FS.Config()
+		period := time.Duration(cfg.BundleCheckSeconds) * time.Second
+		if period > 0 && cfg.BundleURL != "" {
+			if _, err := FS.UpdateBundle(); err != nil {
+				log.Error.Println("bundle update failed, keeping the current one: ", err)
+			}
+		} else {
+			period = BUNDLE_CHECK_SECONDS * time.Second
+		}
+		select {
+		case <-FS.bundle.stop:
+			return
+		case <-time.After(period):
+		}
+	}
+}
+
+func (FS *FollowSkill) CloseBundleUpdates() {
+	FS.bundle.stopOnce.Do(func() { close(FS.bundle.stop) })
+}
+
+// installBundle writes the bundle's files into a directory of their own, which it returns.
+func installBundle(dir string, manifest facerec.BundleManifest, bundle facerec.ModelBundle) (InstalledBundle, string, error) {
+	installed := InstalledBundle{Manifest: manifest, People: bundle.People}
+	// the checksum keeps a webserver that starts counting again from writing over the bundle in use
+	versionDir := filepath.Join(dir, "v"+strconv.FormatInt(manifest.Version, 10)+"-"+manifest.SHA256[:12])
+	if err := os.MkdirAll(versionDir, 0755); err != nil {
+		return installed, versionDir, err
+	}
+	recognizer, err := json.Marshal(bundle.Recognizer)
+	if err != nil {
+		return installed, versionDir, err
+	}
+	installed.RecognizerPath = filepath.Join(versionDir, "recognizer.json")
+	if err := fileutil.WriteFileAtomic(installed.RecognizerPath, recognizer); err != nil {
+		return installed, versionDir, err
+	}
+	for name, cascade := range bundle.Cascades {
+		if err := fileutil.WriteFileAtomic(filepath.Join(versionDir, name), []byte(cascade)); err != nil {
+			return installed, versionDir, err
+		}
+	}
+	installed.CascadePath = filepath.Join(versionDir, bundle.Cascade)
+	return installed, versionDir, nil
+}
+
+// removeOtherBundles deletes every bundle directory but keep, the detector has read its cascade by now.
+func removeOtherBundles(dir string, keep string) {
+	matches, _ := filepath.Glob(filepath.Join(dir, "v*"))
+	for _, path := range matches {
+		if path != keep {
+			os.RemoveAll(path)
+		}
+	}
+}
+
+func httpGet(client *http.Client, url string) (*http.Response, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return resp, nil
+}
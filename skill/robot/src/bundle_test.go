@@ -0,0 +1,116 @@
+package examples
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"shared/facerec"
+)
+
+// bundleServer serves bundles the way the webserver does, publish swaps in the next one.
+type bundleServer struct {
+	mu       sync.Mutex
+	data     []byte
+	manifest facerec.BundleManifest
+	// afterManifest runs once the manifest is sent, as a retraining would
+	afterManifest func()
+}
+
+func (s *bundleServer) publish(t *testing.T, version int64) {
+	data, err := json.Marshal(facerec.ModelBundle{Version: version, Cascade: "face.xml", Cascades: map[string]string{"face.xml": "<cascade/>"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = data
+	s.manifest = facerec.NewManifest(facerec.ModelBundle{Version: version}, data)
+}
+
+func (s *bundleServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	data, manifest := s.data, s.manifest
+	s.mu.Unlock()
+	switch r.URL.Path {
+	case "/bundle/manifest":
+		json.NewEncoder(w).Encode(manifest)
+		if s.afterManifest != nil {
+			s.afterManifest()
+			s.afterManifest = nil
+		}
+	case "/bundle":
+		w.Header().Set("ETag", `"`+manifest.SHA256+`"`)
+		w.Header().Set("X-Bundle-Version", strconv.FormatInt(manifest.Version, 10))
+		w.Write(data)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestFetchBundleMatchesManifest(t *testing.T) {
+	s := &bundleServer{}
+	s.publish(t, 1)
+	server := httptest.NewServer(s)
+	defer server.Close()
+	manifest, err := fetchManifest(server.Client(), server.URL+"/bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := fetchBundle(server.Client(), server.URL+"/bundle", manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(s.data) {
+		t.Errorf("downloaded %s, want %s", data, s.data)
+	}
+}
+
+func TestFetchBundleNoticesRepublish(t *testing.T) {
+	s := &bundleServer{}
+	s.publish(t, 1)
+	s.afterManifest = func() { s.publish(t, 2) }
+	server := httptest.NewServer(s)
+	defer server.Close()
+	manifest, err := fetchManifest(server.Client(), server.URL+"/bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fetchBundle(server.Client(), server.URL+"/bundle", manifest); err != errBundleChanged {
+		t.Errorf("bundle 2 against manifest 1: err = %v, want errBundleChanged", err)
+	}
+}
+
+func TestFetchBundleRejectsCorruptDownload(t *testing.T) {
+	s := &bundleServer{}
+	s.publish(t, 1)
+	server := httptest.NewServer(s)
+	defer server.Close()
+	manifest, err := fetchManifest(server.Client(), server.URL+"/bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	s.data = append([]byte{' '}, s.data[1:]...)
+	s.mu.Unlock()
+	if _, err := fetchBundle(server.Client(), server.URL+"/bundle", manifest); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("corrupt download: err = %v, want a mismatch", err)
+	}
+}
+
+func TestFetchManifestRejectsBadChecksum(t *testing.T) {
+	for _, sha := range []string{"", "abc", strings.Repeat("zz", 32), strings.Repeat("ab", 32) + "/.."} {
+		s := &bundleServer{}
+		s.publish(t, 1)
+		s.manifest.SHA256 = sha
+		server := httptest.NewServer(s)
+		if _, err := fetchManifest(server.Client(), server.URL+"/bundle"); err == nil {
+			t.Errorf("sha256 %q accepted", sha)
+		}
+		server.Close()
+	}
+}
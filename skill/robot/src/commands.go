@@ -0,0 +1,140 @@
+package examples
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"mind/core/framework/log"
+	"strings"
+)
+
+/*====================================================
+COMMANDS
+The remote sends {"id": "7", "command": "config", "args": {...}}
+and gets back an ack message whose payload is
+{"id": "7", "command": "config", "ok": true, "result": ...}
+or {"id": "7", "command": "config", "ok": false, "error": "..."}.
+Bare strings from older remotes ("stop", "config {...}") are still
+accepted: the first word is the command, the rest its args.
+=====================================================*/
+
+type Command struct {
+	ID   string          `json:"id"`
+	Name string          `json:"command"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+type Reply struct {
+	ID      string      `json:"id"`
+	Command string      `json:"command"`
+	OK      bool        `json:"ok"`
+	Error   string      `json:"error,omitempty"`
+	Result  interface{} `json:"result,omitempty"`
+}
+
+// CommandHandler runs one command, the result is sent back in the reply.
+type CommandHandler func(FS *FollowSkill, args json.RawMessage) (interface{}, error)
+
+var commandHandlers = map[string]CommandHandler{}
+
+// RegisterCommand adds a handler, files that add commands call it from init.
+func RegisterCommand(name string, handler CommandHandler) {
+	if _, exists := commandHandlers[name]; exists {
+		panic("command registered twice: " + name)
+	}
+	commandHandlers[name] = handler
+}
+
+func init() {
+	RegisterCommand("test", func(FS *FollowSkill, args json.RawMessage) (interface{}, error) {
+		return nil, FS.sendDataToServer()
+	})
+	RegisterCommand("start", startCommand)
+	RegisterCommand("spinAround", startCommand)
+	RegisterCommand("stop", func(FS *FollowSkill, args json.RawMessage) (interface{}, error) {
+		FS.Stop()
+		return FS.state.Current().String(), nil
+	})
+	RegisterCommand("pic", func(FS *FollowSkill, args json.RawMessage) (interface{}, error) {
+		FS.PitchTest()
+		view := FS.TakePicAndSend("pic", FS.body.Direction(), FS.Config().GroundToFacePitch)
+		if view.image == nil {
+			return nil, errors.New("no picture from the camera")
+		}
+		return view.id, nil
+	})
+	RegisterCommand("state", func(FS *FollowSkill, args json.RawMessage) (interface{}, error) {
+		return FS.state.Current().String(), nil
+	})
+	RegisterCommand("config", func(FS *FollowSkill, args json.RawMessage) (interface{}, error) {
+		if len(args) == 0 || string(args) == "null" {
+			return FS.Config(), nil
+		}
+		err := FS.UpdateConfig(func(cfg Config) (Config, error) {
+			return cfg.Merge(args)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return FS.Config(), nil
+	})
+}
+
+func startCommand(FS *FollowSkill, args json.RawMessage) (interface{}, error) {
+	FS.FollowAsync(context.Background())
+	return FS.state.Current().String(), nil
+}
+
+// ParseCommand reads a JSON envelope, or a bare "name args" string from older remotes.
+func ParseCommand(data string) (Command, error) {
+	data = strings.TrimSpace(data)
+	if strings.HasPrefix(data, "{") {
+		var cmd Command
+		if err := json.Unmarshal([]byte(data), &cmd); err != nil {
+			return cmd, err
+		}
+		if cmd.Name == "" {
+			return cmd, errors.New("missing command")
+		}
+		return cmd, nil
+	}
+	parts := strings.SplitN(data, " ", 2)
+	cmd := Command{Name: parts[0]}
+	if cmd.Name == "" {
+		return cmd, errors.New("missing command")
+	}
+	if len(parts) == 2 {
+		args := strings.TrimSpace(parts[1])
+		if !json.Valid([]byte(args)) {
+			quoted, _ := json.Marshal(args)
+			args = string(quoted)
+		}
+		cmd.Args = json.RawMessage(args)
+	}
+	return cmd, nil
+}
+
+// HandleCommand runs cmd through the registry and returns the reply for it.
+func (FS *FollowSkill) HandleCommand(cmd Command) Reply {
+	reply := Reply{ID: cmd.ID, Command: cmd.Name}
+	handler, ok := commandHandlers[cmd.Name]
+	if !ok {
+		reply.Error = "unknown command " + cmd.Name
+		return reply
+	}
+	result, err := handler(FS, cmd.Args)
+	if err != nil {
+		reply.Error = err.Error()
+		return reply
+	}
+	reply.OK = true
+	reply.Result = result
+	return reply
+}
+
+func (FS *FollowSkill) SendReply(reply Reply) {
+	if !reply.OK {
+		log.Error.Println("command ", reply.Command, " failed: ", reply.Error)
+	}
+	SendMessage(MessageAck, reply)
+}
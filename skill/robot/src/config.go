@@ -0,0 +1,386 @@
+package examples
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"mind/core/framework/log"
+	"net"
+	"net/url"
+	"os"
+	"time"
+
+	"shared/facerec"
+)
+
+const CONFIG_PATH = "assets/config.json"
+const DEFAULT_SERVER_ADDRESS = "10.0.0.85:8080"
+
+/*
+Config
+Description: every tuning value of the skill. It is loaded from CONFIG_PATH on
+start, anything missing from the file keeps its default. A recognitionThreshold
+of 0 uses the threshold the recognizer was trained with, an empty bundleUrl or a
+bundleCheckSeconds of 0 stops fetching model bundles. targetPolicy names the
+TargetSelector that picks between faces. Values are read where
+they are used, so a change made at runtime shows up on the next sweep, the PID
+and standoff settings on the next face lock, and the view buffer size on the
+next follow.
+*/
+type Config struct {
+	IntervalDegrees       float64         `json:"intervalDegrees"`
+	GroundToFacePitch     float64         `json:"groundToFacePitch"`
+	MovementDurationMs    int             `json:"movementDurationMs"`
+	SettleDelayMs         int             `json:"settleDelayMs"`
+	ViewExpirationSeconds int             `json:"viewExpirationSeconds"`
+	ViewBufferSize        int             `json:"viewBufferSize"`
+	LostFaceFrames        int             `json:"lostFaceFrames"`
+	FollowTimeoutSeconds  int             `json:"followTimeoutSeconds"`
+	TargetPolicy          string          `json:"targetPolicy"`
+	CascadePath           string          `json:"cascadePath"`
+	DetectorPoolSize      int             `json:"detectorPoolSize"`
+	DetectionBackend      string          `json:"detectionBackend"`
+	AnalyzeURL            string          `json:"analyzeUrl"`
+	AnalyzeTimeoutMs      int             `json:"analyzeTimeoutMs"`
+	RecognizerPath        string          `json:"recognizerPath"`
+	RecognitionThreshold  float64         `json:"recognitionThreshold"`
+	BundleURL             string          `json:"bundleUrl"`
+	BundleCheckSeconds    int             `json:"bundleCheckSeconds"`
+	BundleDir             string          `json:"bundleDir"`
+	ServerAddress         string          `json:"serverAddress"`
+	ServerTLS             ServerTLSConfig `json:"serverTls"`
+	AnnotateFrames        bool            `json:"annotateFrames"`
+	Uplink                UplinkConfig    `json:"uplink"`
+	Preview               PreviewConfig   `json:"preview"`
+	Detector              DetectorParams  `json:"detector"`
+	YawPID                PIDParams       `json:"yawPid"`
+	PitchPID              PIDParams       `json:"pitchPid"`
+	Standoff              StandoffParams  `json:"standoff"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		IntervalDegrees:       SIZE_OF_INTERVAL_IN_DEGREES,
+		GroundToFacePitch:     GROUND_TO_FACE_PITCH_ANGLE,
+		MovementDurationMs:    TIME_TO_COMPLETE_MOVEMENT,
+		SettleDelayMs:         int(TIME_TO_SLEEP_AFTER_MOVEMENT_IN_MS / time.Millisecond),
+		ViewExpirationSeconds: VIEW_EXPIRATION_IN_SECONDS,
+		ViewBufferSize:        ALL_VIEWS_BUFFER_SIZE,
+		LostFaceFrames:        LOST_FACE_FRAMES,
+		FollowTimeoutSeconds:  FOLLOW_TIMEOUT_IN_SECONDS,
+		TargetPolicy:          POLICY_LARGEST,
+		CascadePath:           CASCADE_PATH,
+		DetectorPoolSize:      DETECTOR_POOL_SIZE,
+		DetectionBackend:      BACKEND_LOCAL,
+		AnalyzeURL:            DEFAULT_ANALYZE_URL,
+		AnalyzeTimeoutMs:      ANALYZE_TIMEOUT_IN_MS,
+		RecognizerPath:        RECOGNIZER_PATH,
+		BundleURL:             DEFAULT_BUNDLE_URL,
+		BundleCheckSeconds:    BUNDLE_CHECK_SECONDS,
+		BundleDir:             BUNDLE_DIR,
+		ServerAddress:         DEFAULT_SERVER_ADDRESS,
+		Uplink:                DefaultUplinkConfig(),
+		Preview:               DefaultPreviewConfig(),
+		Detector:              DefaultDetectorParams(),
+		YawPID:                DefaultYawPID(),
+		PitchPID:              DefaultPitchPID(),
+		Standoff:              DefaultStandoffParams(),
+	}
+}
+
+/*
+ServerTLSConfig
+Description: how the skill connects to the webserver's robot listener. With
+Enabled the connection is TLS, checked against CAFile when it is set (the
+webserver's -cert is usually self signed). CertFile and KeyFile are the robot's own
+certificate, needed when the webserver runs with -client-ca.
+*/
+type ServerTLSConfig struct {
+	Enabled    bool   `json:"enabled"`
+	CAFile     string `json:"caFile,omitempty"`
+	CertFile   string `json:"certFile,omitempty"`
+	KeyFile    string `json:"keyFile,omitempty"`
+	ServerName string `json:"serverName,omitempty"`
+}
+
+func (t ServerTLSConfig) ClientConfig() (*tls.Config, error) {
+	config := &tls.Config{ServerName: t.ServerName, MinVersion: tls.VersionTLS12}
+	if t.CAFile != "" {
+		pem, err := ioutil.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", t.CAFile)
+		}
+	}
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// LoadConfig reads path over the defaults. A missing file is not an error, the defaults are used.
+func LoadConfig(path string) (Config, error) {
+	cfg := DefaultConfig()
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		log.Info.Println("no config at ", path, ", using defaults")
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	if err := decodeConfig(data, &cfg); err != nil {
+		return DefaultConfig(), fmt.Errorf("config %s: %v", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return DefaultConfig(), fmt.Errorf("config %s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// Merge applies a partial JSON document on top of cfg and validates the result.
+func (cfg Config) Merge(patch []byte) (Config, error) {
+	if err := decodeConfig(patch, &cfg); err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// decodeConfig is json.Unmarshal that rejects unknown fields, so a misspelled setting is an error instead of a default.
+func decodeConfig(data []byte, cfg interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(cfg)
+}
+
+func (cfg Config) Validate() error {
+	switch {
+	case cfg.IntervalDegrees <= 0 || cfg.IntervalDegrees > 360:
+		return errors.New("intervalDegrees must be in (0, 360]")
+	case math.Abs(cfg.GroundToFacePitch) > PITCH_LIMIT_IN_DEGREES:
+		return fmt.Errorf("groundToFacePitch must be within +/-%v", PITCH_LIMIT_IN_DEGREES)
+	case cfg.MovementDurationMs <= 0:
+		return errors.New("movementDurationMs must be positive")
+	case cfg.SettleDelayMs < 0:
+		return errors.New("settleDelayMs must not be negative")
+	case cfg.ViewExpirationSeconds <= 0:
+		return errors.New("viewExpirationSeconds must be positive")
+	case cfg.ViewBufferSize < 1:
+		return errors.New("viewBufferSize must be at least 1")
+	case cfg.LostFaceFrames < 1:
+		return errors.New("lostFaceFrames must be at least 1")
+	case cfg.FollowTimeoutSeconds <= 0:
+		return errors.New("followTimeoutSeconds must be positive")
+	case targetSelectors[cfg.TargetPolicy] == nil:
+		return fmt.Errorf("targetPolicy must be one of %v", TargetPolicies())
+	case cfg.CascadePath == "":
+		return errors.New("cascadePath is required")
+	case cfg.DetectorPoolSize < 1:
+		return errors.New("detectorPoolSize must be at least 1")
+	case cfg.DetectionBackend != BACKEND_LOCAL && cfg.DetectionBackend != BACKEND_REMOTE && cfg.DetectionBackend != BACKEND_FALLBACK:
+		return fmt.Errorf("detectionBackend must be %s, %s or %s", BACKEND_LOCAL, BACKEND_REMOTE, BACKEND_FALLBACK)
+	case cfg.AnalyzeTimeoutMs <= 0:
+		return errors.New("analyzeTimeoutMs must be positive")
+	case cfg.RecognitionThreshold < 0:
+		return errors.New("recognitionThreshold must not be negative")
+	case cfg.BundleCheckSeconds < 0:
+		return errors.New("bundleCheckSeconds must not be negative")
+	case cfg.BundleDir == "":
+		return errors.New("bundleDir is required")
+	}
+	if u, err := url.Parse(cfg.AnalyzeURL); err != nil || u.Host == "" {
+		return errors.New("analyzeUrl must be an absolute URL")
+	}
+	if u, err := url.Parse(cfg.BundleURL); cfg.BundleURL != "" && (err != nil || u.Host == "") {
+		return errors.New("bundleUrl must be empty or an absolute URL")
+	}
+	if _, _, err := net.SplitHostPort(cfg.ServerAddress); err != nil {
+		return fmt.Errorf("serverAddress: %v", err)
+	}
+	if (cfg.ServerTLS.CertFile == "") != (cfg.ServerTLS.KeyFile == "") {
+		return errors.New("serverTls needs both certFile and keyFile, or neither")
+	}
+
+	for name, stream := range cfg.Uplink.streams() {
+		switch {
+		case stream.MaxWidth < 0 || stream.MaxHeight < 0:
+			return fmt.Errorf("uplink.%s sizes must not be negative", name)
+		case stream.Quality < 0 || stream.Quality > 100:
+			return fmt.Errorf("uplink.%s.quality must be in [0, 100]", name)
+		case stream.MaxFPS < 0:
+			return fmt.Errorf("uplink.%s.maxFps must not be negative", name)
+		case stream.QueueSize < 1:
+			return fmt.Errorf("uplink.%s.queueSize must be at least 1", name)
+		}
+	}
+
+	if err := cfg.Preview.Validate(); err != nil {
+		return err
+	}
+
+	d := cfg.Detector
+	switch {
+	case d.ScaleFactor <= 1:
+		return errors.New("detector.scaleFactor must be greater than 1")
+	case d.MinNeighbors < 0:
+		return errors.New("detector.minNeighbors must not be negative")
+	case d.MinSize < 0 || d.MaxSize < 0:
+		return errors.New("detector sizes must not be negative")
+	case d.MaxSize != 0 && d.MaxSize < d.MinSize:
+		return errors.New("detector.maxSize must be 0 or at least minSize")
+	}
+
+	for name, pid := range map[string]PIDParams{"yawPid": cfg.YawPID, "pitchPid": cfg.PitchPID} {
+		if pid.Kp < 0 || pid.Ki < 0 || pid.Kd < 0 || pid.Deadband < 0 || pid.MaxOutput < 0 || pid.MaxRate < 0 || pid.IntegralLimit < 0 {
+			return fmt.Errorf("%s values must not be negative", name)
+		}
+	}
+
+	s := cfg.Standoff
+	switch {
+	case s.Distance <= 0:
+		return errors.New("standoff.distance must be positive")
+	case s.Hysteresis < 0 || s.Hysteresis >= s.Distance:
+		return errors.New("standoff.hysteresis must be in [0, distance)")
+	case s.SensorMin < 0 || s.SensorMax <= s.SensorMin:
+		return errors.New("standoff sensor range is empty")
+	case s.SensorWeight < 0 || s.SensorWeight > 1:
+		return errors.New("standoff.sensorWeight must be in [0, 1]")
+	case s.MaxDisagreement < 0:
+		return errors.New("standoff.maxDisagreement must not be negative")
+	}
+	return nil
+}
+
+// Intervals is how many head positions one sweep takes.
+func (cfg Config) Intervals() int {
+	return int(math.Ceil(360 / cfg.IntervalDegrees))
+}
+
+func (cfg Config) MovementDuration() time.Duration {
+	return time.Duration(cfg.MovementDurationMs) * time.Millisecond
+}
+
+func (cfg Config) SettleDelay() time.Duration {
+	return time.Duration(cfg.SettleDelayMs) * time.Millisecond
+}
+
+func (cfg Config) AnalyzeTimeout() time.Duration {
+	return time.Duration(cfg.AnalyzeTimeoutMs) * time.Millisecond
+}
+
+// detectorChanged is true when going from old to cfg needs a new detector rather than new params.
+func (cfg Config) detectorChanged(old Config) bool {
+	return cfg.CascadePath != old.CascadePath ||
+		cfg.DetectorPoolSize != old.DetectorPoolSize ||
+		cfg.DetectionBackend != old.DetectionBackend ||
+		cfg.AnalyzeURL != old.AnalyzeURL ||
+		cfg.AnalyzeTimeoutMs != old.AnalyzeTimeoutMs
+}
+
+func (cfg Config) FollowTimeout() time.Duration {
+	return time.Duration(cfg.FollowTimeoutSeconds) * time.Second
+}
+
+func (cfg Config) ViewExpiration() time.Duration {
+	return time.Duration(cfg.ViewExpirationSeconds) * time.Second
+}
+
+/* FollowSkill accessors */
+
+func (FS *FollowSkill) Config() Config {
+	FS.configMu.Lock()
+	defer FS.configMu.Unlock()
+	return FS.config
+}
+
+/*
+SetConfig
+Description: validates and applies cfg while the skill runs. Uplink settings apply
+to the next frame sent. Detector parameters apply to the next frame; a new cascade
+path, pool size or detection backend builds a new detector and releases the old
+one once its in-flight detections are done. A new recognizer path is loaded
+first, a model that does not load leaves everything as it was.
+*/
+func (FS *FollowSkill) SetConfig(cfg Config) error {
+	FS.configUpdateMu.Lock()
+	defer FS.configUpdateMu.Unlock()
+	return FS.setConfig(cfg)
+}
+
+// UpdateConfig applies change to the config in use, no other update lands between reading it and setting the result.
+func (FS *FollowSkill) UpdateConfig(change func(cfg Config) (Config, error)) error {
+	FS.configUpdateMu.Lock()
+	defer FS.configUpdateMu.Unlock()
+	cfg, err := change(FS.Config())
+	if err != nil {
+		return err
+	}
+	return FS.setConfig(cfg)
+}
+
+func (FS *FollowSkill) setConfig(cfg Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	FS.configMu.Lock()
+	old := FS.config
+	FS.configMu.Unlock()
+	recognizerChanged := cfg.RecognizerPath != old.RecognizerPath
+	var recognizer *facerec.RecognizerModel
+	if recognizerChanged {
+		var err error
+		if recognizer, err = LoadRecognizer(cfg.RecognizerPath); err != nil {
+			return err
+		}
+	}
+	FS.configMu.Lock()
+	FS.config = cfg
+	FS.configMu.Unlock()
+
+	if cfg.detectorChanged(old) || FS.faceDetector() == nil {
+		detector, err := NewDetector(cfg)
+		if err != nil {
+			FS.configMu.Lock()
+			FS.config = old
+			FS.configMu.Unlock()
+			return err
+		}
+		if previous := FS.swapDetector(detector); previous != nil {
+			go previous.Close()
+		}
+	} else if detector := FS.faceDetector(); detector != nil {
+		detector.SetParams(cfg.Detector)
+	}
+	FS.uplink.Configure(cfg.Uplink)
+	if recognizerChanged {
+		FS.swapRecognizer(recognizer)
+	}
+	return nil
+}
+
+func (FS *FollowSkill) faceDetector() Detector {
+	FS.configMu.Lock()
+	defer FS.configMu.Unlock()
+	return FS.detector
+}
+
+func (FS *FollowSkill) swapDetector(detector Detector) Detector {
+	FS.configMu.Lock()
+	defer FS.configMu.Unlock()
+	previous := FS.detector
+	FS.detector = detector
+	return previous
+}
@@ -0,0 +1,60 @@
+package examples
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The shipped file is read directly, LoadConfig would fall back to the defaults without it.
+func TestLoadShippedConfig(t *testing.T) {
+	data, err := ioutil.ReadFile("../" + CONFIG_PATH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig()
+	if err := decodeConfig(data, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// A detector that fails to build leaves the config and the uplink as they were.
+func TestSetConfigRollsBack(t *testing.T) {
+	sim := NewSimulator()
+	FS := NewFollowSkill(sim, sim, sim)
+	defer FS.uplink.Close()
+	old := FS.Config()
+	cfg := old
+	cfg.CascadePath = "testdata/no-such-cascade.xml"
+	cfg.Uplink.Frames.Quality = old.Uplink.Frames.Quality - 10
+	if err := FS.SetConfig(cfg); err == nil {
+		t.Fatal("a missing cascade was accepted")
+	}
+	if got := FS.Config(); !reflect.DeepEqual(got, old) {
+		t.Errorf("config %+v after a failed update, want %+v", got, old)
+	}
+	frames := FS.uplink.streams[STREAM_FRAMES]
+	frames.mu.Lock()
+	defer frames.mu.Unlock()
+	if frames.cfg != old.Uplink.Frames {
+		t.Errorf("frames stream has %+v after a failed update, want %+v", frames.cfg, old.Uplink.Frames)
+	}
+}
+
+func TestMergeRejectsUnknownFields(t *testing.T) {
+	cfg := DefaultConfig()
+	if _, err := cfg.Merge([]byte(`{"intervalDgrees": 30}`)); err == nil || !strings.Contains(err.Error(), "intervalDgrees") {
+		t.Errorf("misspelled field: err = %v, want an unknown field error", err)
+	}
+	merged, err := cfg.Merge([]byte(`{"intervalDegrees": 30}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.IntervalDegrees != 30 {
+		t.Errorf("intervalDegrees = %v, want 30", merged.IntervalDegrees)
+	}
+}
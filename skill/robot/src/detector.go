@@ -0,0 +1,119 @@
+package examples
+
+import (
+	"errors"
+	"image"
+	"sync"
+
+	"github.com/lazywei/go-opencv/opencv"
+	"shared/haar"
+)
+
+const CASCADE_PATH = "assets/haarcascade_frontalface_alt.xml"
+const DETECTOR_POOL_SIZE = 2
+
+var errDetectorClosed = errors.New("face detector closed")
+
+/* DetectorParams are handed straight to cvHaarDetectObjects, sizes are in pixels and 0 means no limit */
+type DetectorParams struct {
+	ScaleFactor  float64 `json:"scaleFactor"`
+	MinNeighbors int     `json:"minNeighbors"`
+	MinSize      int     `json:"minSize"`
+	MaxSize      int     `json:"maxSize"`
+}
+
+func DefaultDetectorParams() DetectorParams {
+	return DetectorParams{
+		ScaleFactor:  1.1,
+		MinNeighbors: 3,
+		MinSize:      0,
+		MaxSize:      0,
+	}
+}
+
+func (p DetectorParams) haar() haar.Params {
+	return haar.Params{ScaleFactor: p.ScaleFactor, MinNeighbors: p.MinNeighbors, MinSize: p.MinSize, MaxSize: p.MaxSize}
+}
+
+/*
+FaceDetector
+Description: loads the cascade once per pool slot and reuses it for every frame.
+Each cascade is only used by one goroutine at a time, so Detect can be called
+from as many goroutines as needed; callers beyond the pool size wait their turn.
+*/
+type FaceDetector struct {
+	mu        sync.Mutex
+	params    DetectorParams
+	size      int
+	cascades  chan *haar.Cascade
+	closeOnce sync.Once
+}
+
+func NewFaceDetector(path string, poolSize int, params DetectorParams) (*FaceDetector, error) {
+	if poolSize < 1 {
+		poolSize = 1
+	}
+	fd := &FaceDetector{
+		params:   params,
+		cascades: make(chan *haar.Cascade, poolSize),
+	}
+	for i := 0; i < poolSize; i++ {
+		cascade, err := haar.Load(path)
+		if err != nil {
+			fd.Close()
+			return nil, err
+		}
+		fd.cascades <- cascade
+		fd.size++
+	}
+	return fd, nil
+}
+
+func (fd *FaceDetector) Params() DetectorParams {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	return fd.params
+}
+
+// SetParams takes effect from the next call to Detect.
+func (fd *FaceDetector) SetParams(params DetectorParams) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	fd.params = params
+}
+
+// Detect returns every face in img.
+func (fd *FaceDetector) Detect(img *image.RGBA) ([]Detection, error) {
+	if img == nil {
+		return nil, errors.New("no image")
+	}
+	cascade, ok := <-fd.cascades
+	if !ok {
+		return nil, errDetectorClosed
+	}
+	defer func() { fd.cascades <- cascade }()
+
+	cvimg := opencv.FromImage(img)
+	if cvimg == nil {
+		return nil, errors.New("could not convert image")
+	}
+	defer cvimg.Release()
+
+	params := fd.Params()
+	hits := cascade.Detect(cvimg, params.haar())
+	faces := make([]Detection, 0, len(hits))
+	for _, hit := range hits {
+		faces = append(faces, NewDetection(hit.Rect, img.Bounds(), hit.Neighbors, params.MinNeighbors))
+	}
+	return faces, nil
+}
+
+// Close waits for in-flight detections and releases every cascade.
+func (fd *FaceDetector) Close() {
+	fd.closeOnce.Do(func() {
+		for i := 0; i < fd.size; i++ {
+			(<-fd.cascades).Release()
+		}
+		close(fd.cascades)
+	})
+}
@@ -0,0 +1,211 @@
+package examples
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"mind/core/framework/log"
+	"strconv"
+	"strings"
+	"time"
+
+	"shared/facerec"
+)
+
+/*====================================================
+FOLLOW BY IDENTITY
+"follow <personID>" runs the follow pipeline for one enrolled
+person: views with only strangers in them are not escalated,
+and once locked on, the servo tracks that person's face and
+treats everyone else as a miss. When the person has not been
+seen for FollowTimeoutSeconds, the remote gets a target
+message with status "notFound" and the follow stops.
+A plain "start" follows whoever shows up first.
+=====================================================*/
+
+const FOLLOW_TIMEOUT_IN_SECONDS = 60
+const TARGET_CHECK_PERIOD = time.Second
+
+const (
+	TARGET_FOUND     = "found"
+	TARGET_NOT_FOUND = "notFound"
+)
+
+func init() {
+	RegisterCommand("follow", func(FS *FollowSkill, args json.RawMessage) (interface{}, error) {
+		personID, err := parseFollowArgs(args)
+		if err != nil {
+			return nil, err
+		}
+		if err := FS.canFollow(personID); err != nil {
+			return nil, err
+		}
+		if FS.TargetPerson() != personID {
+			FS.Stop()
+		}
+		FS.FollowPersonAsync(context.Background(), personID)
+		return FS.state.Current().String(), nil
+	})
+}
+
+/* TargetStatus tells the remote how the search for the person being followed is going */
+type TargetStatus struct {
+	PersonID   string `json:"personId"`
+	Status     string `json:"status"`
+	LastSeenAt int64  `json:"lastSeenAt,omitempty"`
+}
+
+// parseFollowArgs takes "2", {"personId": "2"}, or a bare "follow 2" from older remotes, which arrives as the number 2.
+func parseFollowArgs(args json.RawMessage) (string, error) {
+	var personID string
+	var number json.Number
+	var req struct {
+		PersonID string `json:"personId"`
+	}
+	switch {
+	case json.Unmarshal(args, &personID) == nil:
+	case json.Unmarshal(args, &number) == nil:
+		personID = number.String()
+	case json.Unmarshal(args, &req) == nil:
+		personID = req.PersonID
+	}
+	personID = strings.TrimSpace(personID)
+	if personID == "" {
+		return "", errors.New("follow needs a person ID")
+	}
+	if personID == facerec.UNKNOWN_PERSON {
+		return "", errors.New("can't follow " + facerec.UNKNOWN_PERSON + ", use start to follow anyone")
+	}
+	return personID, nil
+}
+
+// canFollow checks that faces can be told apart and, when the bundle lists people, that personID is one of them.
+func (FS *FollowSkill) canFollow(personID string) error {
+	if FS.faceRecognizer() == nil && FS.Config().DetectionBackend == BACKEND_LOCAL {
+		return errors.New("no recognizer loaded, faces can't be told apart")
+	}
+	if installed := FS.Bundle(); installed != nil && len(installed.People) > 0 {
+		if _, ok := FS.knownPerson(personID); !ok {
+			return errors.New("person " + personID + " is not in recognizer bundle " + strconv.FormatInt(installed.Manifest.Version, 10))
+		}
+	}
+	return nil
+}
+
+// TargetPerson is the person being followed, empty when following anyone.
+func (FS *FollowSkill) TargetPerson() string {
+	FS.targetMu.Lock()
+	defer FS.targetMu.Unlock()
+	return FS.targetPerson
+}
+
+func (FS *FollowSkill) setTargetPerson(personID string) {
+	FS.targetMu.Lock()
+	defer FS.targetMu.Unlock()
+	FS.targetPerson = personID
+	FS.targetSeenAt = time.Time{}
+	FS.target = nil
+}
+
+func (FS *FollowSkill) targetLastSeen() time.Time {
+	FS.targetMu.Lock()
+	defer FS.targetMu.Unlock()
+	return FS.targetSeenAt
+}
+
+// targetCandidates are the faces in views worth going after, those of the person being followed or all of them when following anyone. Seeing the person resets the not found timeout.
+func (FS *FollowSkill) targetCandidates(views ...View) []Candidate {
+	FS.targetMu.Lock()
+	defer FS.targetMu.Unlock()
+	var candidates []Candidate
+	for _, view := range views {
+		for _, face := range view.detections {
+			if FS.targetPerson != "" && face.PersonID != FS.targetPerson {
+				continue
+			}
+			candidates = append(candidates, Candidate{View: view, Face: face})
+			if FS.targetPerson != "" && view.timestamp.After(FS.targetSeenAt) {
+				FS.targetSeenAt = view.timestamp
+			}
+		}
+	}
+	return candidates
+}
+
+// targetSelector is the configured target policy, largest when it is unknown.
+func (FS *FollowSkill) targetSelector() TargetSelector {
+	selector, err := NewTargetSelector(FS.Config().TargetPolicy)
+	if err != nil {
+		log.Error.Println(err)
+		return LargestSelector{}
+	}
+	return selector
+}
+
+/*
+findTarget
+Description: the face in views to go after, picked from the candidates by
+selector with the head pointing at heading. The pick becomes the current
+target the sticky policy holds on to.
+*/
+func (FS *FollowSkill) findTarget(selector TargetSelector, heading float64, views ...View) (Candidate, bool) {
+	candidates := FS.targetCandidates(views...)
+	if len(candidates) == 0 {
+		return Candidate{}, false
+	}
+	FS.targetMu.Lock()
+	defer FS.targetMu.Unlock()
+	chosen := selector.Select(candidates, Selection{Heading: heading, Current: FS.target})
+	FS.target = &Target{PersonID: chosen.Face.PersonID, Bearing: chosen.Bearing(), SeenAt: chosen.View.timestamp}
+	return chosen, true
+}
+
+// targetDecided reports whether selector has its pick among the faces in views already, so more views could not change it.
+func (FS *FollowSkill) targetDecided(selector TargetSelector, heading float64, views ...View) bool {
+	decider, ok := selector.(DecidingSelector)
+	if !ok {
+		return false
+	}
+	candidates := FS.targetCandidates(views...)
+	if len(candidates) == 0 {
+		return false
+	}
+	FS.targetMu.Lock()
+	defer FS.targetMu.Unlock()
+	return decider.Decided(candidates, Selection{Heading: heading, Current: FS.target})
+}
+
+// watchTarget ends the follow through cancel when personID has not been seen for the timeout, counting from started.
+func (FS *FollowSkill) watchTarget(ctx context.Context, cancel context.CancelFunc, personID string, started time.Time) {
+	ticker := time.NewTicker(TARGET_CHECK_PERIOD)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			seen := FS.targetLastSeen()
+			since := started
+			if seen.After(since) {
+				since = seen
+			}
+			if now.Sub(since) < FS.Config().FollowTimeout() {
+				break
+			}
+			status := TargetStatus{PersonID: personID, Status: TARGET_NOT_FOUND}
+			if !seen.IsZero() {
+				status.LastSeenAt = unixMillis(seen)
+			}
+			SendMessage(MessageTarget, status)
+			log.Info.Println(personID, " not found for ", now.Sub(since))
+			// a finished sweep may have declared the person lost already
+			if !FS.state.Is(StateLost) {
+				if err := FS.state.Transition(StateLost, personID+" not found"); err != nil {
+					log.Error.Println(err)
+				}
+			}
+			cancel()
+			return
+		}
+	}
+}
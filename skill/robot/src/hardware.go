@@ -0,0 +1,85 @@
+package examples
+
+import (
+	"errors"
+	"image"
+	"mind/core/framework/drivers/distance"
+	"mind/core/framework/drivers/hexabody"
+	"mind/core/framework/drivers/media"
+)
+
+/*====================================================
+HARDWARE
+Body, Camera and RangeSensor are everything the follow
+skill needs from the robot. The Mind* types forward to
+the mind drivers, anything else (a simulator, a fake)
+can be handed to NewFollowSkill instead.
+=====================================================*/
+
+type Body interface {
+	Start() error
+	Close()
+	Stand() error
+	MoveHead(direction float64, duration int) error
+	Pitch(angle float64, duration int) error
+	StopPitch()
+	Walk(direction float64, duration int) error
+	StopWalkingContinuously()
+	Direction() float64
+}
+
+type Camera interface {
+	Start() error
+	Close()
+	SnapshotRGBA() *image.RGBA
+}
+
+type RangeSensor interface {
+	Start() error
+	Close()
+	Value() (float64, error)
+}
+
+/* MindBody */
+type MindBody struct{}
+
+func (MindBody) Start() error { return hexabody.Start() }
+func (MindBody) Close()       { hexabody.Close() }
+func (MindBody) Stand() error { return hexabody.Stand() }
+
+func (MindBody) MoveHead(direction float64, duration int) error {
+	return hexabody.MoveHead(direction, duration)
+}
+
+func (MindBody) Pitch(angle float64, duration int) error {
+	return hexabody.Pitch(angle, duration)
+}
+
+func (MindBody) StopPitch() { hexabody.StopPitch() }
+
+func (MindBody) Walk(direction float64, duration int) error {
+	return hexabody.Walk(direction, duration)
+}
+
+func (MindBody) StopWalkingContinuously() { hexabody.StopWalkingContinuously() }
+func (MindBody) Direction() float64       { return hexabody.Direction() }
+
+/* MindCamera */
+type MindCamera struct{}
+
+func (MindCamera) Start() error {
+	if !media.Available() {
+		return errors.New("media driver not available")
+	}
+	return media.Start()
+}
+
+func (MindCamera) Close()                    { media.Close() }
+func (MindCamera) SnapshotRGBA() *image.RGBA { return media.SnapshotRGBA() }
+
+/* MindRangeSensor */
+type MindRangeSensor struct{}
+
+func (MindRangeSensor) Start() error            { return distance.Start() }
+func (MindRangeSensor) Close()                  { distance.Close() }
+func (MindRangeSensor) Value() (float64, error) { return distance.Value() }
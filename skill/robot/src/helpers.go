@@ -1,108 +1,146 @@
 package examples
 
 import (
-	"bytes"
-	"encoding/base64"
 	"image"
-	"image/jpeg"
-	"mind/core/framework"
-	"mind/core/framework/drivers/hexabody"
-	"mind/core/framework/drivers/media"
+	"image/color"
+	"image/draw"
 	"mind/core/framework/log"
 	"strconv"
 	"time"
-
-	"github.com/lazywei/go-opencv/opencv"
 )
 
-func PitchTest() {
+const ANNOTATION_THICKNESS = 3
+
+func (FS *FollowSkill) PitchTest() {
 	log.Info.Println("PitchTest")
-	hexabody.Stand()
-	hexabody.Pitch(float64(GROUND_TO_FACE_PITCH_ANGLE), 100)
+	FS.body.Stand()
+	FS.body.Pitch(FS.Config().GroundToFacePitch, 100)
 	// legs := hexabody.PitchRoll(angle, direction)
 	// for i := 0; i < 6; i++ {
 	// 	legs.SetLegPosition(i, legs[i])
 	// }
 }
 
-func SendImage(image *image.RGBA) {
-	buf := new(bytes.Buffer)
-	jpeg.Encode(buf, image, nil)
-	str := base64.StdEncoding.EncodeToString(buf.Bytes())
-	framework.SendString(str)
+// Annotate returns a copy of img with a box drawn around every detection.
+func Annotate(img *image.RGBA, detections []Detection) *image.RGBA {
+	if img == nil {
+		return nil
+	}
+	out := image.NewRGBA(img.Bounds())
+	draw.Draw(out, out.Bounds(), img, img.Bounds().Min, draw.Src)
+	box := &image.Uniform{color.RGBA{0, 255, 0, 255}}
+	for _, d := range detections {
+		r := d.Rect
+		for _, edge := range []image.Rectangle{
+			image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+ANNOTATION_THICKNESS),
+			image.Rect(r.Min.X, r.Max.Y-ANNOTATION_THICKNESS, r.Max.X, r.Max.Y),
+			image.Rect(r.Min.X, r.Min.Y, r.Min.X+ANNOTATION_THICKNESS, r.Max.Y),
+			image.Rect(r.Max.X-ANNOTATION_THICKNESS, r.Min.Y, r.Max.X, r.Max.Y),
+		} {
+			draw.Draw(out, edge.Intersect(out.Bounds()), box, image.ZP, draw.Src)
+		}
+	}
+	return out
 }
 
-func TakePic() *image.RGBA {
+// NewDetectionOverlay lists the face boxes of the view, they line up with the image sent for the same view.
+func NewDetectionOverlay(view View) DetectionOverlay {
+	overlay := DetectionOverlay{
+		FrameID:    view.id,
+		Direction:  view.direction,
+		Pitch:      view.angle,
+		CapturedAt: unixMillis(view.timestamp),
+		Faces:      make([]FaceBox, 0, len(view.detections)),
+	}
+	if view.image != nil {
+		overlay.Width = view.image.Bounds().Dx()
+		overlay.Height = view.image.Bounds().Dy()
+	}
+	for _, face := range view.detections {
+		overlay.Faces = append(overlay.Faces, NewFaceBox(face, view.direction))
+	}
+	return overlay
+}
+
+// SendView queues the frame and its detections on the frames stream, with the boxes burned in when the config asks for it,
+// and reports the people recognized in it to the webserver.
+func (FS *FollowSkill) SendView(view View) {
+	FS.uplink.Enqueue(STREAM_FRAMES, view, FS.Config().AnnotateFrames)
+	FS.reportSightings(view)
+}
+
+func (FS *FollowSkill) TakePic() *image.RGBA {
 	log.Info.Println("taking photo")
-	image := media.SnapshotRGBA()
+	image := FS.camera.SnapshotRGBA()
 	return image
 }
 
-func TakePicAndSend() *image.RGBA {
-	pic := TakePic()
-	SendImage(pic)
-	return pic
+func (FS *FollowSkill) TakePicAndSend(name string, direction float64, pitch float64) View {
+	view := NewView(name, FS.TakePic(), direction, pitch, time.Now())
+	FS.uplink.Enqueue(STREAM_SNAPSHOTS, view, false)
+	return view
 }
 
-func Idle() {
-	hexabody.StopPitch()
-	hexabody.MoveHead(0, 300)
+func (FS *FollowSkill) Idle() {
+	FS.body.StopPitch()
+	FS.body.MoveHead(0, 300)
 }
 
-func Reset() {
-	hexabody.StopPitch()
-	hexabody.MoveHead(0, 300)
+func (FS *FollowSkill) Reset() {
+	FS.body.StopPitch()
+	FS.body.MoveHead(0, 300)
 }
 
 func logger(msg string) {
 	log.Info.Println("=================")
 	log.Info.Println(msg)
 	log.Info.Println("=================")
+	SendLog("info", msg)
 }
 
 //===========================
 
-//interval is number of 30 degree rotations from given view
-func look(view View, interval int32) View {
-	direction := LookAt2(view.direction+float64(SIZE_OF_INTERVAL_IN_DEGREES*interval), GROUND_TO_FACE_PITCH_ANGLE)
-	image := TakePic()
-	return NewView("Look-"+strconv.Itoa(int(direction)), image, direction, GROUND_TO_FACE_PITCH_ANGLE, time.Now())
+// interval is number of 30 degree rotations from given view
+func (FS *FollowSkill) look(view View, interval int32) View {
+	cfg := FS.Config()
+	direction := FS.LookAt2(view.direction+cfg.IntervalDegrees*float64(interval), cfg.GroundToFacePitch)
+	image := FS.TakePic()
+	return NewView("Look-"+strconv.Itoa(int(direction)), image, direction, cfg.GroundToFacePitch, time.Now())
 }
 
-func lookAtView(view View) View {
-	hexabody.Stand()
+func (FS *FollowSkill) lookAtView(view View) View {
+	FS.body.Stand()
 	log.Info.Println("fn lookAtView")
-	LookAt2(view.direction, view.angle)
+	FS.LookAt2(view.direction, view.angle)
 	return view
 }
 
-func LookAt2(direction float64, angle float64) float64 {
+// LookAt2 turns the head to direction and pitches it to pitch, it returns -1 when the head can't turn.
+func (FS *FollowSkill) LookAt2(direction float64, pitch float64) float64 {
 	//log.Info.Println("look at called")
 	//maybe run movements in parallel? closure is needed
-	err := hexabody.MoveHead(direction, TIME_TO_COMPLETE_MOVEMENT)
+	cfg := FS.Config()
+	err := FS.body.MoveHead(direction, cfg.MovementDurationMs)
 	if err != nil {
 		log.Error.Println("Move head failed")
 		return -1
 	}
-	hexabody.Pitch(float64(GROUND_TO_FACE_PITCH_ANGLE), TIME_TO_COMPLETE_MOVEMENT)
-	time.Sleep(TIME_TO_SLEEP_AFTER_MOVEMENT_IN_MS) //first picture blurry, others seem good.
+	FS.body.Pitch(pitch, cfg.MovementDurationMs)
+	time.Sleep(cfg.SettleDelay()) //first picture blurry, others seem good.
 	return direction
 }
 
-func ContainsFace(image *image.RGBA) bool {
-	var cvimg *opencv.IplImage
-	var faces []*opencv.Rect
-	if image == nil {
-		log.Error.Println("NO IMAGE")
+// DetectFaces returns every face in image, recognized when there is a recognizer. Failures are logged and reported as no faces.
+func (FS *FollowSkill) DetectFaces(image *image.RGBA) []Detection {
+	detector := FS.faceDetector()
+	if detector == nil {
+		log.Error.Println("NO DETECTOR")
+		return nil
 	}
-	cvimg = opencv.FromImage(image)
-	if cvimg == nil {
-		log.Error.Println("NO CVIMG")
-	}
-	faces = opencv.LoadHaarClassifierCascade("assets/haarcascade_frontalface_alt.xml").DetectObjects(cvimg)
-	if len(faces) > 0 {
-		return true
+	faces, err := detector.Detect(image)
+	if err != nil {
+		log.Error.Println("face detection failed: ", err)
+		return nil
 	}
-	return false
-
+	return FS.recognize(image, faces)
 }
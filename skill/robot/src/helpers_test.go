@@ -0,0 +1,20 @@
+package examples
+
+import "testing"
+
+func TestLookAt2Pitches(t *testing.T) {
+	sim := NewSimulator()
+	FS := NewFollowSkill(sim, sim, sim)
+	defer FS.uplink.Close()
+	for _, pitch := range []float64{FS.Config().GroundToFacePitch, 5, -10} {
+		if direction := FS.LookAt2(90, pitch); direction != 90 {
+			t.Errorf("LookAt2 returned %v, want 90", direction)
+		}
+		sim.mu.Lock()
+		got, head := sim.pitch, sim.headDirection
+		sim.mu.Unlock()
+		if got != pitch || head != 90 {
+			t.Errorf("head at %v pitched %v, want 90 pitched %v", head, got, pitch)
+		}
+	}
+}
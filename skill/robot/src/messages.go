@@ -0,0 +1,207 @@
+package examples
+
+import (
+	"encoding/json"
+	"fmt"
+	"mind/core/framework"
+	"mind/core/framework/log"
+	"time"
+)
+
+/*====================================================
+MESSAGES
+Everything the skill sends to the remote, and to the webserver, is one JSON envelope:
+
+	{"v": 1, "type": "image", "time": 1527897600000, "payload": {...}}
+
+time is unix milliseconds. The payload shape is fixed by the type,
+see payloadTypes. Bump PROTOCOL_VERSION on any change that an
+older remote could misread; adding optional fields is not one.
+=====================================================*/
+
+const PROTOCOL_VERSION = 1
+
+type MessageType string
+
+const (
+	MessageImage      MessageType = "image"
+	MessageDetections MessageType = "detections"
+	MessageState      MessageType = "state"
+	MessageTelemetry  MessageType = "telemetry"
+	MessageLog        MessageType = "log"
+	MessageAck        MessageType = "ack"
+	MessageSighting   MessageType = "sighting"
+	MessageTarget     MessageType = "target"
+)
+
+type Message struct {
+	Version int             `json:"v"`
+	Type    MessageType     `json:"type"`
+	Time    int64           `json:"time"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+/* ImageFrame is a JPEG from the camera, Data is base64. Annotated frames have the face boxes drawn in, Stream is the uplink stream it came through */
+type ImageFrame struct {
+	FrameID    int64   `json:"frameId"`
+	Stream     string  `json:"stream,omitempty"`
+	Format     string  `json:"format"`
+	Width      int     `json:"width"`
+	Height     int     `json:"height"`
+	Direction  float64 `json:"direction"`
+	Pitch      float64 `json:"pitch"`
+	CapturedAt int64   `json:"capturedAt"`
+	Annotated  bool    `json:"annotated,omitempty"`
+	Data       string  `json:"data"`
+}
+
+/* DetectionOverlay lists the faces found in the frame with the same FrameID, in that frame's pixels */
+type DetectionOverlay struct {
+	FrameID    int64     `json:"frameId"`
+	Width      int       `json:"width"`
+	Height     int       `json:"height"`
+	Direction  float64   `json:"direction"`
+	Pitch      float64   `json:"pitch"`
+	CapturedAt int64     `json:"capturedAt"`
+	Faces      []FaceBox `json:"faces"`
+}
+
+/* FaceBox is a Detection as the remote sees it */
+type FaceBox struct {
+	X          int     `json:"x"`
+	Y          int     `json:"y"`
+	Width      int     `json:"width"`
+	Height     int     `json:"height"`
+	Bearing    float64 `json:"bearing"`
+	Distance   float64 `json:"distance"`
+	Confidence float64 `json:"confidence"`
+	// PersonID and RecognitionDistance are only set when a recognizer is loaded
+	PersonID            string  `json:"personId,omitempty"`
+	RecognitionDistance float64 `json:"recognitionDistance,omitempty"`
+}
+
+/* Sighting goes to the webserver when an enrolled person is recognized, Bearing and Distance as in FaceBox */
+type Sighting struct {
+	PersonID            string  `json:"personId"`
+	RecognitionDistance float64 `json:"recognitionDistance"`
+	FrameID             int64   `json:"frameId"`
+	Bearing             float64 `json:"bearing"`
+	Distance            float64 `json:"distance"`
+	Confidence          float64 `json:"confidence"`
+	CapturedAt          int64   `json:"capturedAt"`
+}
+
+type StateChange struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Reason string `json:"reason"`
+}
+
+/* Telemetry is sent while following, Values holds anything without its own field */
+type Telemetry struct {
+	State     string             `json:"state"`
+	Direction float64            `json:"direction"`
+	Pitch     float64            `json:"pitch"`
+	Distance  float64            `json:"distance,omitempty"`
+	Move      string             `json:"move,omitempty"`
+	Values    map[string]float64 `json:"values,omitempty"`
+}
+
+type LogMessage struct {
+	Level string `json:"level"`
+	Text  string `json:"text"`
+}
+
+// payloadTypes maps every message type to a constructor for its payload, DecodePayload uses it.
+var payloadTypes = map[MessageType]func() interface{}{
+	MessageImage:      func() interface{} { return &ImageFrame{} },
+	MessageDetections: func() interface{} { return &DetectionOverlay{} },
+	MessageState:      func() interface{} { return &StateChange{} },
+	MessageTelemetry:  func() interface{} { return &Telemetry{} },
+	MessageLog:        func() interface{} { return &LogMessage{} },
+	MessageAck:        func() interface{} { return &Reply{} },
+	MessageSighting:   func() interface{} { return &Sighting{} },
+	MessageTarget:     func() interface{} { return &TargetStatus{} },
+}
+
+func NewFaceBox(face Detection, direction float64) FaceBox {
+	return FaceBox{
+		X:                   face.Rect.Min.X,
+		Y:                   face.Rect.Min.Y,
+		Width:               face.Rect.Dx(),
+		Height:              face.Rect.Dy(),
+		Bearing:             face.Bearing(direction),
+		Distance:            face.Distance,
+		Confidence:          face.Confidence,
+		PersonID:            face.PersonID,
+		RecognitionDistance: face.RecognitionDistance,
+	}
+}
+
+// unixMillis is how every time in the protocol is written.
+func unixMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func EncodeMessage(msgType MessageType, payload interface{}, at time.Time) ([]byte, error) {
+	if _, ok := payloadTypes[msgType]; !ok {
+		return nil, fmt.Errorf("unknown message type %q", msgType)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(Message{
+		Version: PROTOCOL_VERSION,
+		Type:    msgType,
+		Time:    unixMillis(at),
+		Payload: data,
+	})
+}
+
+// DecodeMessage reads an envelope, rejecting newer protocol versions and unknown types.
+func DecodeMessage(data []byte) (Message, error) {
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return msg, err
+	}
+	if msg.Version < 1 || msg.Version > PROTOCOL_VERSION {
+		return msg, fmt.Errorf("unsupported protocol version %d", msg.Version)
+	}
+	if _, ok := payloadTypes[msg.Type]; !ok {
+		return msg, fmt.Errorf("unknown message type %q", msg.Type)
+	}
+	return msg, nil
+}
+
+// DecodePayload returns a pointer to the typed payload, e.g. *ImageFrame for MessageImage.
+func (msg Message) DecodePayload() (interface{}, error) {
+	newPayload, ok := payloadTypes[msg.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown message type %q", msg.Type)
+	}
+	payload := newPayload()
+	if err := json.Unmarshal(msg.Payload, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+func (msg Message) Timestamp() time.Time {
+	return time.Unix(0, msg.Time*int64(time.Millisecond))
+}
+
+// SendMessage wraps payload in an envelope and sends it to the remote, returning the bytes sent.
+func SendMessage(msgType MessageType, payload interface{}) int {
+	data, err := EncodeMessage(msgType, payload, time.Now())
+	if err != nil {
+		log.Error.Println("could not encode ", msgType, " message: ", err)
+		return 0
+	}
+	framework.SendString(string(data))
+	return len(data)
+}
+
+func SendLog(level string, text string) {
+	SendMessage(MessageLog, LogMessage{Level: level, Text: text})
+}
@@ -0,0 +1,131 @@
+package examples
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// messageTime is 2018-06-02 00:00:00 UTC, the time in every golden envelope.
+var messageTime = time.Unix(1527897600, 0)
+
+// goldenMessages has a payload of every message type, testdata/messages/<type>.json is its envelope.
+var goldenMessages = map[MessageType]interface{}{
+	MessageImage: &ImageFrame{
+		FrameID: 7, Stream: "preview", Format: "jpeg", Width: 1280, Height: 720,
+		Direction: 92.5, Pitch: 20, CapturedAt: 1527897599950, Annotated: true, Data: "/9j/4AAQ",
+	},
+	MessageDetections: &DetectionOverlay{
+		FrameID: 7, Width: 1280, Height: 720, Direction: 92.5, Pitch: 20, CapturedAt: 1527897599950,
+		Faces: []FaceBox{
+			{X: 600, Y: 200, Width: 120, Height: 120, Bearing: 95, Distance: 2500, Confidence: 0.8, PersonID: "2", RecognitionDistance: 41.5},
+			{X: 100, Y: 250, Width: 60, Height: 60, Bearing: 120.25, Distance: 5000, Confidence: 0.4},
+		},
+	},
+	MessageState:     &StateChange{From: "searching", To: "confirming", Reason: "face in LookAround-90"},
+	MessageTelemetry: &Telemetry{State: "following", Direction: 95, Pitch: 18.5, Distance: 1200, Move: StandoffApproach.String(), Values: map[string]float64{"yawError": -2.5}},
+	MessageLog:       &LogMessage{Level: "error", Text: "look at failed"},
+	MessageAck: &Reply{
+		ID: "3", Command: "target.policy", OK: true,
+		Result: map[string]interface{}{"policy": "sticky", "policies": []interface{}{"heading", "largest"}},
+	},
+	MessageSighting: &Sighting{PersonID: "2", RecognitionDistance: 41.5, FrameID: 7, Bearing: 95, Distance: 2500, Confidence: 0.8, CapturedAt: 1527897599950},
+	MessageTarget:   &TargetStatus{PersonID: "2", Status: TARGET_FOUND, LastSeenAt: 1527897599950},
+}
+
+func goldenPath(msgType MessageType) string {
+	return filepath.Join("testdata", "messages", string(msgType)+".json")
+}
+
+func TestEveryMessageTypeHasGolden(t *testing.T) {
+	for msgType := range payloadTypes {
+		if _, ok := goldenMessages[msgType]; !ok {
+			t.Errorf("no golden message for %q", msgType)
+		}
+	}
+}
+
+func TestEncodeMessageMatchesGolden(t *testing.T) {
+	for msgType, payload := range goldenMessages {
+		data, err := EncodeMessage(msgType, payload, messageTime)
+		if err != nil {
+			t.Errorf("%s: %v", msgType, err)
+			continue
+		}
+		if *updateGolden {
+			if err := ioutil.WriteFile(goldenPath(msgType), data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		golden, err := ioutil.ReadFile(goldenPath(msgType))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, golden) {
+			t.Errorf("%s encodes to\n%s\nwant\n%s", msgType, data, golden)
+		}
+	}
+}
+
+func TestDecodeMessageRoundTrips(t *testing.T) {
+	for msgType, want := range goldenMessages {
+		golden, err := ioutil.ReadFile(goldenPath(msgType))
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg, err := DecodeMessage(golden)
+		if err != nil {
+			t.Errorf("%s: %v", msgType, err)
+			continue
+		}
+		if msg.Type != msgType || !msg.Timestamp().Equal(messageTime) {
+			t.Errorf("%s: decoded type %q at %v", msgType, msg.Type, msg.Timestamp())
+		}
+		payload, err := msg.DecodePayload()
+		if err != nil {
+			t.Errorf("%s: %v", msgType, err)
+			continue
+		}
+		if !reflect.DeepEqual(payload, want) {
+			t.Errorf("%s: decoded %#v, want %#v", msgType, payload, want)
+		}
+		again, err := EncodeMessage(msg.Type, payload, msg.Timestamp())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(again, golden) {
+			t.Errorf("%s re-encodes to\n%s\nwant\n%s", msgType, again, golden)
+		}
+	}
+}
+
+func TestDecodeMessageRejects(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		data string
+		err  string
+	}{
+		{"unknown type", `{"v":1,"type":"teleport","time":0,"payload":{}}`, `unknown message type "teleport"`},
+		{"newer version", `{"v":2,"type":"log","time":0,"payload":{}}`, "unsupported protocol version 2"},
+		{"no version", `{"type":"log","time":0,"payload":{}}`, "unsupported protocol version 0"},
+		{"not json", `image`, "invalid character"},
+	} {
+		if _, err := DecodeMessage([]byte(c.data)); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: err = %v, want %q", c.name, err, c.err)
+		}
+	}
+	if _, err := EncodeMessage("teleport", nil, messageTime); err == nil {
+		t.Error("encoding an unknown type did not fail")
+	}
+	if _, err := (Message{Version: 1, Type: "teleport"}).DecodePayload(); err == nil {
+		t.Error("decoding the payload of an unknown type did not fail")
+	}
+}
@@ -2,31 +2,95 @@ package examples
 
 import (
 	"image"
+	"math"
+	"sync/atomic"
 	"time"
 )
 
+const CAMERA_FIELD_OF_VIEW_IN_DEGREES = 60.0
+const AVERAGE_FACE_WIDTH_IN_MM = 150.0
+
 /* View */
 type View struct {
-	id        int64
-	name      string
-	image     *image.RGBA
-	direction float64
-	angle     float64
-	timestamp time.Time
+	id         int64
+	name       string
+	image      *image.RGBA
+	direction  float64
+	angle      float64
+	timestamp  time.Time
+	detections []Detection
+	sweep      *Sweep
 }
 
+var lastViewID int64
+
+// NewView gives every view its own id, which is also the frame id the remote sees.
 func NewView(name string, image *image.RGBA, direction float64, angle float64, timestamp time.Time) View {
 	return View{
-		id:        time.Now().Unix(),
+		id:        atomic.AddInt64(&lastViewID, 1),
 		name:      name,
 		image:     image,
 		direction: direction,
 		angle:     angle,
-		timestamp: time.Now(),
+		timestamp: timestamp,
 	}
 
 }
 
+/*
+Detection
+Description: one face found in a frame.
+Offsets are pixels from the image center, x grows to the right and y grows down.
+Angles are the same offsets in degrees off the camera axis. Distance is in mm,
+estimated from the box width and an average face width.
+Confidence maps the number of merged cascade windows onto [0, 1).
+PersonID is who the recognizer thinks it is, facerec.UNKNOWN_PERSON when it matches
+nobody and empty when no recognizer is loaded; RecognitionDistance is how far
+the face is from that person's nearest enrolled face.
+*/
+type Detection struct {
+	Rect                image.Rectangle
+	OffsetX             float64
+	OffsetY             float64
+	AngleX              float64
+	AngleY              float64
+	Distance            float64
+	Confidence          float64
+	PersonID            string
+	RecognitionDistance float64
+}
+
+func NewDetection(rect image.Rectangle, frame image.Rectangle, neighbors int, minNeighbors int) Detection {
+	focal := focalLength(frame.Dx())
+	center := image.Pt((rect.Min.X+rect.Max.X)/2, (rect.Min.Y+rect.Max.Y)/2)
+	frameCenter := image.Pt((frame.Min.X+frame.Max.X)/2, (frame.Min.Y+frame.Max.Y)/2)
+	d := Detection{
+		Rect:    rect,
+		OffsetX: float64(center.X - frameCenter.X),
+		OffsetY: float64(center.Y - frameCenter.Y),
+	}
+	d.AngleX = math.Atan2(d.OffsetX, focal) * 180 / math.Pi
+	d.AngleY = math.Atan2(d.OffsetY, focal) * 180 / math.Pi
+	if rect.Dx() > 0 {
+		d.Distance = focal * AVERAGE_FACE_WIDTH_IN_MM / float64(rect.Dx())
+	}
+	if neighbors > 0 {
+		d.Confidence = float64(neighbors) / float64(neighbors+minNeighbors)
+	}
+	return d
+}
+
+// Bearing is the head direction that would put the face in the middle of the frame.
+// Head directions grow to the left, so a face right of center is at a smaller direction.
+func (d Detection) Bearing(direction float64) float64 {
+	return math.Mod(direction-d.AngleX+360, 360)
+}
+
+// focalLength in pixels for a frame of the given width.
+func focalLength(width int) float64 {
+	return float64(width) / 2 / math.Tan(CAMERA_FIELD_OF_VIEW_IN_DEGREES/2*math.Pi/180)
+}
+
 //func (view View) UpdateImage(){
 
 //}
@@ -0,0 +1,201 @@
+package examples
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"io/ioutil"
+	"mind/core/framework/log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*====================================================
+DETECTION OFFLOAD
+Face detection can run on the robot, on the webserver's
+POST /analyze, or on the webserver with the robot taking
+over whenever the server is slow or unreachable. Every
+backend hands back the same Detections, so the follow
+pipeline does not know where detection ran.
+=====================================================*/
+
+const (
+	BACKEND_LOCAL    = "local"
+	BACKEND_REMOTE   = "remote"
+	BACKEND_FALLBACK = "fallback"
+)
+
+const DEFAULT_ANALYZE_URL = "http://10.0.0.85:8000/analyze"
+const ANALYZE_TIMEOUT_IN_MS = 1500
+const ANALYZE_JPEG_QUALITY = 90
+
+// REMOTE_RETRY_AFTER is how long the fallback backend stays local after the server fails.
+const REMOTE_RETRY_AFTER = time.Second * 10
+
+type Detector interface {
+	Detect(img *image.RGBA) ([]Detection, error)
+	SetParams(params DetectorParams)
+	Close()
+}
+
+// NewDetector builds the backend cfg.DetectionBackend names.
+func NewDetector(cfg Config) (Detector, error) {
+	switch cfg.DetectionBackend {
+	case BACKEND_LOCAL:
+		local, err := NewFaceDetector(cfg.CascadePath, cfg.DetectorPoolSize, cfg.Detector)
+		if err != nil {
+			return nil, err // a nil *FaceDetector would make a non-nil Detector
+		}
+		return local, nil
+	case BACKEND_REMOTE:
+		return NewRemoteDetector(cfg.AnalyzeURL, cfg.AnalyzeTimeout(), cfg.Detector), nil
+	case BACKEND_FALLBACK:
+		local, err := NewFaceDetector(cfg.CascadePath, cfg.DetectorPoolSize, cfg.Detector)
+		if err != nil {
+			return nil, err
+		}
+		return NewFallbackDetector(NewRemoteDetector(cfg.AnalyzeURL, cfg.AnalyzeTimeout(), cfg.Detector), local), nil
+	}
+	return nil, fmt.Errorf("unknown detection backend %q", cfg.DetectionBackend)
+}
+
+/* analyzeFace and analyzeResult are the parts of the webserver's /analyze answer the skill reads, in the pixels of the frame sent */
+type analyzeFace struct {
+	X                   int     `json:"x"`
+	Y                   int     `json:"y"`
+	Width               int     `json:"width"`
+	Height              int     `json:"height"`
+	Neighbors           int     `json:"neighbors"`
+	PersonID            string  `json:"personId"`
+	RecognitionDistance float64 `json:"recognitionDistance"`
+}
+
+type analyzeResult struct {
+	Faces []analyzeFace `json:"faces"`
+}
+
+/*
+RemoteDetector
+Description: posts each frame as a JPEG to the webserver's analysis endpoint
+with the detector params in the query, and gives up after the timeout.
+*/
+type RemoteDetector struct {
+	mu     sync.Mutex
+	url    string
+	params DetectorParams
+	client *http.Client
+}
+
+func NewRemoteDetector(analyzeURL string, timeout time.Duration, params DetectorParams) *RemoteDetector {
+	return &RemoteDetector{
+		url:    analyzeURL,
+		params: params,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (rd *RemoteDetector) SetParams(params DetectorParams) {
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+	rd.params = params
+}
+
+func (rd *RemoteDetector) Detect(img *image.RGBA) ([]Detection, error) {
+	if img == nil {
+		return nil, errors.New("no image")
+	}
+	rd.mu.Lock()
+	params := rd.params
+	rd.mu.Unlock()
+
+	buf := new(bytes.Buffer)
+	if err := jpeg.Encode(buf, img, &jpeg.Options{Quality: ANALYZE_JPEG_QUALITY}); err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	query.Set("scaleFactor", strconv.FormatFloat(params.ScaleFactor, 'f', -1, 64))
+	query.Set("minNeighbors", strconv.Itoa(params.MinNeighbors))
+	query.Set("minSize", strconv.Itoa(params.MinSize))
+	query.Set("maxSize", strconv.Itoa(params.MaxSize))
+
+	resp, err := rd.client.Post(rd.url+"?"+query.Encode(), "image/jpeg", buf)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("analyze: %s %s", resp.Status, bytes.TrimSpace(body))
+	}
+	var result analyzeResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("analyze: %v", err)
+	}
+
+	frame := img.Bounds()
+	faces := make([]Detection, 0, len(result.Faces))
+	for _, face := range result.Faces {
+		rect := image.Rect(face.X, face.Y, face.X+face.Width, face.Y+face.Height).Add(frame.Min)
+		detection := NewDetection(rect, frame, face.Neighbors, params.MinNeighbors)
+		detection.PersonID = face.PersonID
+		detection.RecognitionDistance = face.RecognitionDistance
+		faces = append(faces, detection)
+	}
+	return faces, nil
+}
+
+func (rd *RemoteDetector) Close() {}
+
+/*
+FallbackDetector
+Description: uses primary until it fails, then uses fallback for
+REMOTE_RETRY_AFTER before trying primary again, so a dead server costs one
+timeout every retry period instead of one per frame.
+*/
+type FallbackDetector struct {
+	mu       sync.Mutex
+	primary  Detector
+	fallback Detector
+	failedAt time.Time
+}
+
+func NewFallbackDetector(primary Detector, fallback Detector) *FallbackDetector {
+	return &FallbackDetector{primary: primary, fallback: fallback}
+}
+
+func (fd *FallbackDetector) Detect(img *image.RGBA) ([]Detection, error) {
+	fd.mu.Lock()
+	usePrimary := fd.failedAt.IsZero() || time.Since(fd.failedAt) > REMOTE_RETRY_AFTER
+	fd.mu.Unlock()
+	if usePrimary {
+		faces, err := fd.primary.Detect(img)
+		if err == nil {
+			fd.mu.Lock()
+			fd.failedAt = time.Time{}
+			fd.mu.Unlock()
+			return faces, nil
+		}
+		log.Error.Println("remote detection failed, detecting locally: ", err)
+		fd.mu.Lock()
+		fd.failedAt = time.Now()
+		fd.mu.Unlock()
+	}
+	return fd.fallback.Detect(img)
+}
+
+func (fd *FallbackDetector) SetParams(params DetectorParams) {
+	fd.primary.SetParams(params)
+	fd.fallback.SetParams(params)
+}
+
+func (fd *FallbackDetector) Close() {
+	fd.primary.Close()
+	fd.fallback.Close()
+}
@@ -0,0 +1,173 @@
+package examples
+
+import (
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// analyzeServer answers POST /analyze with faces, or with status when it is not 200.
+type analyzeServer struct {
+	mu       sync.Mutex
+	status   int
+	faces    []analyzeFace
+	requests int
+	query    map[string]string
+	size     image.Point
+}
+
+func (s *analyzeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	s.query = map[string]string{}
+	for name := range r.URL.Query() {
+		s.query[name] = r.URL.Query().Get(name)
+	}
+	if r.Header.Get("Content-Type") == "image/jpeg" {
+		if config, err := jpeg.DecodeConfig(r.Body); err == nil {
+			s.size = image.Pt(config.Width, config.Height)
+		}
+	}
+	if s.status != 0 && s.status != http.StatusOK {
+		http.Error(w, "no detector", s.status)
+		return
+	}
+	json.NewEncoder(w).Encode(analyzeResult{Faces: s.faces})
+}
+
+func (s *analyzeServer) set(status int, faces ...analyzeFace) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status, s.faces = status, faces
+}
+
+func (s *analyzeServer) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// fakeDetector stands in for the local detector.
+type fakeDetector struct {
+	mu    sync.Mutex
+	faces []Detection
+	calls int
+}
+
+func (d *fakeDetector) Detect(img *image.RGBA) ([]Detection, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.calls++
+	return d.faces, nil
+}
+
+func (d *fakeDetector) SetParams(params DetectorParams) {}
+func (d *fakeDetector) Close()                          {}
+
+func testFrame() *image.RGBA {
+	return image.NewRGBA(image.Rect(0, 0, 320, 240))
+}
+
+func TestRemoteDetectorMapsFaces(t *testing.T) {
+	s := &analyzeServer{faces: []analyzeFace{{X: 100, Y: 50, Width: 40, Height: 40, Neighbors: 6, PersonID: "2", RecognitionDistance: 12.5}}}
+	server := httptest.NewServer(s)
+	defer server.Close()
+	params := DefaultDetectorParams()
+	rd := NewRemoteDetector(server.URL+"/analyze", time.Second, params)
+
+	// the server answers in the pixels of the JPEG, which start at 0,0 whatever the frame bounds
+	frame := testFrame().SubImage(image.Rect(20, 10, 260, 190)).(*image.RGBA)
+	faces, err := rd.Detect(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(faces) != 1 {
+		t.Fatalf("%d faces, want 1", len(faces))
+	}
+	want := NewDetection(image.Rect(120, 60, 160, 100), frame.Bounds(), 6, params.MinNeighbors)
+	want.PersonID, want.RecognitionDistance = "2", 12.5
+	if faces[0] != want {
+		t.Errorf("face %+v, want %+v", faces[0], want)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.size != image.Pt(240, 180) {
+		t.Errorf("server got a %v JPEG, want the 240x180 frame", s.size)
+	}
+	if s.query["minNeighbors"] != strconv.Itoa(params.MinNeighbors) || s.query["scaleFactor"] != strconv.FormatFloat(params.ScaleFactor, 'f', -1, 64) {
+		t.Errorf("query %v does not carry the detector params %+v", s.query, params)
+	}
+}
+
+func TestRemoteDetectorTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+	rd := NewRemoteDetector(server.URL+"/analyze", 50*time.Millisecond, DefaultDetectorParams())
+
+	start := time.Now()
+	if _, err := rd.Detect(testFrame()); err == nil {
+		t.Error("a server that never answers gave no error")
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("Detect took %v with a 50ms timeout", took)
+	}
+}
+
+func TestRemoteDetectorRejectsErrorStatus(t *testing.T) {
+	s := &analyzeServer{status: http.StatusServiceUnavailable}
+	server := httptest.NewServer(s)
+	defer server.Close()
+	rd := NewRemoteDetector(server.URL+"/analyze", time.Second, DefaultDetectorParams())
+	_, err := rd.Detect(testFrame())
+	if err == nil || !strings.Contains(err.Error(), "503") || !strings.Contains(err.Error(), "no detector") {
+		t.Errorf("err = %v, want the status and the server's message", err)
+	}
+}
+
+func TestFallbackDetectorRetriesAfterWaiting(t *testing.T) {
+	s := &analyzeServer{faces: []analyzeFace{{X: 10, Y: 10, Width: 40, Height: 40}}}
+	server := httptest.NewServer(s)
+	defer server.Close()
+	local := &fakeDetector{faces: []Detection{{PersonID: "local"}}}
+	fd := NewFallbackDetector(NewRemoteDetector(server.URL+"/analyze", time.Second, DefaultDetectorParams()), local)
+
+	detect := func(step string, wantLocal bool, wantRequests int) {
+		t.Helper()
+		faces, err := fd.Detect(testFrame())
+		if err != nil {
+			t.Fatalf("%s: %v", step, err)
+		}
+		if gotLocal := len(faces) == 1 && faces[0].PersonID == "local"; gotLocal != wantLocal {
+			t.Errorf("%s: faces %+v, local %v, want local %v", step, faces, gotLocal, wantLocal)
+		}
+		if got := s.count(); got != wantRequests {
+			t.Errorf("%s: %d requests to the server, want %d", step, got, wantRequests)
+		}
+	}
+	detect("server up", false, 1)
+	s.set(http.StatusInternalServerError)
+	detect("server failing", true, 2)
+	s.set(http.StatusOK, analyzeFace{X: 10, Y: 10, Width: 40, Height: 40})
+	detect("server back within the retry period", true, 2)
+
+	fd.mu.Lock()
+	fd.failedAt = time.Now().Add(-REMOTE_RETRY_AFTER - time.Second)
+	fd.mu.Unlock()
+	detect("retry period over", false, 3)
+	detect("server in use again", false, 4)
+	if local.calls != 2 {
+		t.Errorf("local detector ran %d times, want 2", local.calls)
+	}
+}
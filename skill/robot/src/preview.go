@@ -0,0 +1,266 @@
+package examples
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mind/core/framework/log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+/*====================================================
+PREVIEW
+A live view of the camera outside of the follow pipeline.
+While it runs the camera is sampled Preview.FPS times a second
+and each frame goes out on the preview uplink stream, and to
+every client of the MJPEG endpoint at
+
+	http://<robot><httpAddress>/preview.mjpg
+
+which a browser <img> tag or ffmpeg -i can read directly.
+=====================================================*/
+
+const MJPEG_PATH = "/preview.mjpg"
+const MJPEG_BOUNDARY = "frame"
+
+func init() {
+	RegisterCommand("preview.start", func(FS *FollowSkill, args json.RawMessage) (interface{}, error) {
+		cfg := FS.Config().Preview
+		if len(args) != 0 && string(args) != "null" {
+			if err := decodeConfig(args, &cfg); err != nil {
+				return nil, fmt.Errorf("preview.start: %v", err)
+			}
+		}
+		if err := FS.StartPreview(cfg); err != nil {
+			return nil, err
+		}
+		return cfg, nil
+	})
+	RegisterCommand("preview.stop", func(FS *FollowSkill, args json.RawMessage) (interface{}, error) {
+		FS.StopPreview()
+		return nil, nil
+	})
+}
+
+/* PreviewConfig, an empty HTTPAddress means no MJPEG endpoint */
+type PreviewConfig struct {
+	FPS         float64 `json:"fps"`
+	Annotate    bool    `json:"annotate"`
+	HTTPAddress string  `json:"httpAddress"`
+}
+
+func DefaultPreviewConfig() PreviewConfig {
+	return PreviewConfig{FPS: 5, HTTPAddress: ":8081"}
+}
+
+func (cfg PreviewConfig) Validate() error {
+	if cfg.FPS <= 0 || cfg.FPS > 30 {
+		return errors.New("preview.fps must be in (0, 30]")
+	}
+	if cfg.HTTPAddress != "" {
+		if _, _, err := net.SplitHostPort(cfg.HTTPAddress); err != nil {
+			return fmt.Errorf("preview.httpAddress: %v", err)
+		}
+	}
+	return nil
+}
+
+type preview struct {
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+	mjpeg  *MJPEGServer
+}
+
+/*
+StartPreview
+Description: starts sampling the camera, replacing a preview that is already
+running. Annotated previews run face detection on every frame, so keep the
+rate low on the robot when Annotate is set.
+*/
+func (FS *FollowSkill) StartPreview(cfg PreviewConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	FS.StopPreview()
+
+	var mjpeg *MJPEGServer
+	if cfg.HTTPAddress != "" {
+		var err error
+		if mjpeg, err = ListenMJPEG(cfg.HTTPAddress); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	FS.preview.mu.Lock()
+	FS.preview.cancel = cancel
+	FS.preview.done = done
+	FS.preview.mjpeg = mjpeg
+	FS.preview.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		if mjpeg != nil {
+			defer mjpeg.Close()
+		}
+		FS.runPreview(ctx, cfg, mjpeg)
+	}()
+	logger("preview started")
+	return nil
+}
+
+// StopPreview stops the preview and waits for it, it does nothing when no preview runs.
+func (FS *FollowSkill) StopPreview() {
+	FS.preview.mu.Lock()
+	cancel, done := FS.preview.cancel, FS.preview.done
+	FS.preview.cancel, FS.preview.done, FS.preview.mjpeg = nil, nil, nil
+	FS.preview.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+	logger("preview stopped")
+}
+
+func (FS *FollowSkill) runPreview(ctx context.Context, cfg PreviewConfig, mjpeg *MJPEGServer) {
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / cfg.FPS))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		img := FS.camera.SnapshotRGBA()
+		if img == nil {
+			continue
+		}
+		view := NewView("Preview", img, FS.body.Direction(), FS.Config().GroundToFacePitch, time.Now())
+		if cfg.Annotate {
+			view.detections = FS.DetectFaces(img)
+		}
+		FS.uplink.Enqueue(STREAM_PREVIEW, view, cfg.Annotate)
+
+		if mjpeg != nil && mjpeg.Clients() > 0 {
+			if cfg.Annotate {
+				img = Annotate(img, view.detections)
+			}
+			data, _, err := encodeFrame(img, FS.Config().Uplink.Preview)
+			if err != nil {
+				log.Error.Println("could not encode preview: ", err)
+				continue
+			}
+			mjpeg.Publish(data)
+		}
+	}
+}
+
+/*
+MJPEGServer
+Description: serves the latest published JPEG to any number of clients as a
+multipart/x-mixed-replace stream. A slow client only ever has the newest frame
+waiting for it, older ones are dropped instead of queueing up.
+*/
+type MJPEGServer struct {
+	mu       sync.Mutex
+	clients  map[chan []byte]struct{}
+	server   *http.Server
+	listener net.Listener
+}
+
+// ListenMJPEG starts serving MJPEG_PATH on address.
+func ListenMJPEG(address string) (*MJPEGServer, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	m := &MJPEGServer{clients: make(map[chan []byte]struct{}), listener: listener}
+	mux := http.NewServeMux()
+	mux.HandleFunc(MJPEG_PATH, m.ServeHTTP)
+	m.server = &http.Server{Handler: mux}
+	go func() {
+		if err := m.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Error.Println("mjpeg server: ", err)
+		}
+	}()
+	log.Info.Println("mjpeg preview on ", listener.Addr().String(), MJPEG_PATH)
+	return m, nil
+}
+
+// Addr is where the server listens, with the port filled in when httpAddress left it to the system.
+func (m *MJPEGServer) Addr() net.Addr {
+	return m.listener.Addr()
+}
+
+func (m *MJPEGServer) Clients() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.clients)
+}
+
+// Publish hands frame to every client, replacing the frame a client has not picked up yet.
+func (m *MJPEGServer) Publish(frame []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for client := range m.clients {
+		select {
+		case <-client:
+		default:
+		}
+		client <- frame
+	}
+}
+
+func (m *MJPEGServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	client := make(chan []byte, 1)
+	m.mu.Lock()
+	m.clients[client] = struct{}{}
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.clients, client)
+		m.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+MJPEG_BOUNDARY)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case frame := <-client:
+			_, err := fmt.Fprintf(w, "--%s\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", MJPEG_BOUNDARY, len(frame))
+			if err == nil {
+				_, err = w.Write(frame)
+			}
+			if err == nil {
+				_, err = w.Write([]byte("\r\n"))
+			}
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// Close stops the server and drops every client.
+func (m *MJPEGServer) Close() {
+	if err := m.server.Close(); err != nil {
+		log.Error.Println("mjpeg server close: ", err)
+	}
+}
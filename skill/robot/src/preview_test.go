@@ -0,0 +1,78 @@
+package examples
+
+import (
+	"image/jpeg"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPreviewStartRejectsUnknownFields(t *testing.T) {
+	sim := NewSimulator()
+	FS := NewFollowSkill(sim, sim, sim)
+	defer FS.uplink.Close()
+	reply := FS.HandleCommand(Command{Name: "preview.start", Args: []byte(`{"fps": 5, "anotate": true}`)})
+	if reply.OK || !strings.Contains(reply.Error, "anotate") {
+		t.Errorf("reply %+v, want an unknown field error", reply)
+	}
+	reply = FS.HandleCommand(Command{Name: "preview.start", Args: []byte(`{"fps": 0}`)})
+	if reply.OK {
+		t.Errorf("reply %+v, want fps rejected", reply)
+	}
+	FS.StopPreview()
+}
+
+func TestPreviewServesMJPEGUntilStopped(t *testing.T) {
+	sim := NewSimulator()
+	FS := NewFollowSkill(sim, sim, sim)
+	defer FS.uplink.Close()
+	if reply := FS.HandleCommand(Command{Name: "preview.start", Args: []byte(`{"fps": 30, "httpAddress": "127.0.0.1:0"}`)}); !reply.OK {
+		t.Fatal(reply.Error)
+	}
+	defer FS.StopPreview()
+	FS.preview.mu.Lock()
+	addr := FS.preview.mjpeg.Addr().String()
+	FS.preview.mu.Unlock()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get("http://" + addr + MJPEG_PATH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/x-mixed-replace" || params["boundary"] != MJPEG_BOUNDARY {
+		t.Fatalf("Content-Type %q, want multipart/x-mixed-replace with boundary %q", resp.Header.Get("Content-Type"), MJPEG_BOUNDARY)
+	}
+	parts := multipart.NewReader(resp.Body, MJPEG_BOUNDARY)
+	for i := 0; i < 2; i++ {
+		part, err := parts.NextPart()
+		if err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		if part.Header.Get("Content-Type") != "image/jpeg" {
+			t.Errorf("frame %d is %q", i, part.Header.Get("Content-Type"))
+		}
+		if _, err := jpeg.Decode(part); err != nil {
+			t.Errorf("frame %d: %v", i, err)
+		}
+	}
+
+	if reply := FS.HandleCommand(Command{Name: "preview.stop"}); !reply.OK {
+		t.Fatal(reply.Error)
+	}
+	// the stream ends and nothing listens any more
+	for {
+		if _, err := parts.NextPart(); err != nil {
+			break
+		}
+	}
+	if conn, err := net.DialTimeout("tcp", addr, time.Second); err == nil {
+		conn.Close()
+		t.Error("the MJPEG server still accepts connections after preview.stop")
+	}
+}
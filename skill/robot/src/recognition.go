@@ -0,0 +1,114 @@
+package examples
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"shared/facerec"
+)
+
+/*====================================================
+RECOGNITION
+Every detected face is matched against the people enrolled
+on the webserver, using the model POST /recognizer/train
+writes (data/recognizer.json there, copied to
+RecognizerPath here). Faces get a PersonID, or
+facerec.UNKNOWN_PERSON, and recognized people are reported to the
+webserver as sightings.
+=====================================================*/
+
+const RECOGNIZER_PATH = "assets/recognizer.json"
+
+// SIGHTING_INTERVAL is how often one person is reported to the webserver at most.
+const SIGHTING_INTERVAL = time.Second * 2
+
+// LoadRecognizer reads a trained model. A missing file is not an error, recognition is off until there is one.
+func LoadRecognizer(path string) (*facerec.RecognizerModel, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var model facerec.RecognizerModel
+	if err := json.Unmarshal(data, &model); err != nil {
+		return nil, fmt.Errorf("recognizer %s: %v", path, err)
+	}
+	if err := model.Validate(); err != nil {
+		return nil, fmt.Errorf("recognizer %s: %v", path, err)
+	}
+	return &model, nil
+}
+
+// faceRecognizer is the loaded model with the configured threshold, nil when there is none.
+func (FS *FollowSkill) faceRecognizer() *facerec.RecognizerModel {
+	FS.configMu.Lock()
+	defer FS.configMu.Unlock()
+	if FS.recognizer == nil || FS.config.RecognitionThreshold == 0 {
+		return FS.recognizer
+	}
+	model := *FS.recognizer
+	model.Threshold = FS.config.RecognitionThreshold
+	return &model
+}
+
+func (FS *FollowSkill) swapRecognizer(model *facerec.RecognizerModel) *facerec.RecognizerModel {
+	FS.configMu.Lock()
+	defer FS.configMu.Unlock()
+	previous := FS.recognizer
+	FS.recognizer = model
+	return previous
+}
+
+// recognize labels the faces found in img; faces the webserver already recognized keep its answer.
+func (FS *FollowSkill) recognize(img *image.RGBA, faces []Detection) []Detection {
+	model := FS.faceRecognizer()
+	if model == nil {
+		return faces
+	}
+	for i := range faces {
+		if faces[i].PersonID != "" {
+			continue
+		}
+		result := model.Predict(facerec.NormalizeFace(img, faces[i].Rect))
+		faces[i].PersonID = result.PersonID
+		faces[i].RecognitionDistance = result.Distance
+	}
+	return faces
+}
+
+func NewSighting(face Detection, view View) Sighting {
+	return Sighting{
+		PersonID:            face.PersonID,
+		RecognitionDistance: face.RecognitionDistance,
+		FrameID:             view.id,
+		Bearing:             face.Bearing(view.direction),
+		Distance:            face.Distance,
+		Confidence:          face.Confidence,
+		CapturedAt:          unixMillis(view.timestamp),
+	}
+}
+
+// reportSightings tells the webserver about every recognized person in view, each at most once per SIGHTING_INTERVAL.
+func (FS *FollowSkill) reportSightings(view View) {
+	FS.sightingsMu.Lock()
+	defer FS.sightingsMu.Unlock()
+	for _, face := range view.detections {
+		if face.PersonID == "" || face.PersonID == facerec.UNKNOWN_PERSON {
+			continue
+		}
+		if view.timestamp.Sub(FS.lastSightings[face.PersonID]) < SIGHTING_INTERVAL {
+			continue
+		}
+		FS.lastSightings[face.PersonID] = view.timestamp
+		FS.server.Send(MessageSighting, NewSighting(face, view))
+	}
+}
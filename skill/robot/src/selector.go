@@ -0,0 +1,252 @@
+package examples
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"shared/facerec"
+)
+
+/*====================================================
+TARGET SELECTION
+When several faces qualify, in one frame or in views that come
+in together, a TargetSelector picks the one to go after:
+
+	largest   the closest face by its size (the default)
+	heading   the face nearest the way the head points
+	recent    the face in the newest frame
+	identity  recognized people before unknown faces
+	sticky    the current target while it is in sight, else largest
+
+The policy comes from targetPolicy in the config, or the
+"target.policy <name>" command; "target.policy" alone lists
+the policies. A new policy applies from the next face that is
+confirmed; a follow keeps the one it started with. Only faces
+of the person being followed are candidates when there is one.
+=====================================================*/
+
+const (
+	POLICY_LARGEST  = "largest"
+	POLICY_HEADING  = "heading"
+	POLICY_RECENT   = "recent"
+	POLICY_IDENTITY = "identity"
+	POLICY_STICKY   = "sticky"
+)
+
+// STICKY_LOST_AFTER is how long the sticky policy holds on to a target it can't see.
+const STICKY_LOST_AFTER = time.Second * 2
+
+// STICKY_BEARING_TOLERANCE is how far an unrecognized face may be from the target's last bearing and still be the target.
+const STICKY_BEARING_TOLERANCE = 15.0
+
+// SELECTION_WINDOW is how long ConfirmFaceFound waits after the first view with a face for others to choose from, unless the policy is a DecidingSelector that has decided.
+const SELECTION_WINDOW = time.Millisecond * 300
+
+func init() {
+	RegisterCommand("target.policy", func(FS *FollowSkill, args json.RawMessage) (interface{}, error) {
+		if len(args) != 0 && string(args) != "null" {
+			var name string
+			if err := json.Unmarshal(args, &name); err != nil {
+				return nil, errors.New("target.policy takes a policy name")
+			}
+			err := FS.UpdateConfig(func(cfg Config) (Config, error) {
+				cfg.TargetPolicy = name
+				return cfg, nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		return TargetPolicyInfo{Policy: FS.Config().TargetPolicy, Policies: TargetPolicies()}, nil
+	})
+}
+
+/* TargetPolicyInfo is the answer to target.policy */
+type TargetPolicyInfo struct {
+	Policy   string   `json:"policy"`
+	Policies []string `json:"policies"`
+}
+
+/* Candidate is one face that could become the target, with the view it is in */
+type Candidate struct {
+	View View
+	Face Detection
+}
+
+func (c Candidate) Bearing() float64 {
+	return c.Face.Bearing(c.View.direction)
+}
+
+func (c Candidate) area() int {
+	return c.Face.Rect.Dx() * c.Face.Rect.Dy()
+}
+
+func (c Candidate) recognized() bool {
+	return c.Face.PersonID != "" && c.Face.PersonID != facerec.UNKNOWN_PERSON
+}
+
+/* Target is what the pipeline last went after */
+type Target struct {
+	PersonID string
+	Bearing  float64
+	SeenAt   time.Time
+}
+
+/* Selection is what a selector knows besides the candidates: where the head points and the current target, nil when there is none */
+type Selection struct {
+	Heading float64
+	Current *Target
+}
+
+type TargetSelector interface {
+	// Select picks one of candidates, which is never empty
+	Select(candidates []Candidate, selection Selection) Candidate
+}
+
+/* DecidingSelector is a TargetSelector that can tell when more candidates would not change its pick */
+type DecidingSelector interface {
+	TargetSelector
+	Decided(candidates []Candidate, selection Selection) bool
+}
+
+var targetSelectors = map[string]TargetSelector{}
+
+// RegisterTargetSelector adds a policy, files that add policies call it from init.
+func RegisterTargetSelector(name string, selector TargetSelector) {
+	if _, exists := targetSelectors[name]; exists {
+		panic("target selector registered twice: " + name)
+	}
+	targetSelectors[name] = selector
+}
+
+func init() {
+	RegisterTargetSelector(POLICY_LARGEST, LargestSelector{})
+	RegisterTargetSelector(POLICY_HEADING, HeadingSelector{})
+	RegisterTargetSelector(POLICY_RECENT, RecentSelector{})
+	RegisterTargetSelector(POLICY_IDENTITY, IdentitySelector{})
+	RegisterTargetSelector(POLICY_STICKY, StickySelector{Fallback: LargestSelector{}})
+}
+
+func TargetPolicies() []string {
+	names := make([]string, 0, len(targetSelectors))
+	for name := range targetSelectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func NewTargetSelector(policy string) (TargetSelector, error) {
+	selector, ok := targetSelectors[policy]
+	if !ok {
+		return nil, fmt.Errorf("unknown target policy %q, want one of %v", policy, TargetPolicies())
+	}
+	return selector, nil
+}
+
+// best returns the candidate less ranks first, keeping the earlier one on ties.
+func best(candidates []Candidate, less func(a Candidate, b Candidate) bool) Candidate {
+	chosen := candidates[0]
+	for _, c := range candidates[1:] {
+		if less(c, chosen) {
+			chosen = c
+		}
+	}
+	return chosen
+}
+
+func angleBetween(a float64, b float64) float64 {
+	return math.Abs(normalizeAngle(a - b))
+}
+
+/* LargestSelector picks the biggest face, which is the closest by the size estimate */
+type LargestSelector struct{}
+
+func (LargestSelector) Select(candidates []Candidate, selection Selection) Candidate {
+	return best(candidates, func(a Candidate, b Candidate) bool { return a.area() > b.area() })
+}
+
+/* HeadingSelector picks the face the head has to turn the least for */
+type HeadingSelector struct{}
+
+func (HeadingSelector) Select(candidates []Candidate, selection Selection) Candidate {
+	return best(candidates, func(a Candidate, b Candidate) bool {
+		return angleBetween(a.Bearing(), selection.Heading) < angleBetween(b.Bearing(), selection.Heading)
+	})
+}
+
+/* RecentSelector picks a face from the newest view, the largest of them */
+type RecentSelector struct{}
+
+func (RecentSelector) Select(candidates []Candidate, selection Selection) Candidate {
+	return best(candidates, func(a Candidate, b Candidate) bool {
+		if !a.View.timestamp.Equal(b.View.timestamp) {
+			return a.View.timestamp.After(b.View.timestamp)
+		}
+		return a.area() > b.area()
+	})
+}
+
+/* IdentitySelector picks recognized people first, the closest match of them, then the largest unknown face */
+type IdentitySelector struct{}
+
+func (IdentitySelector) Select(candidates []Candidate, selection Selection) Candidate {
+	return best(candidates, func(a Candidate, b Candidate) bool {
+		if a.recognized() != b.recognized() {
+			return a.recognized()
+		}
+		if a.recognized() && a.Face.RecognitionDistance != b.Face.RecognitionDistance {
+			return a.Face.RecognitionDistance < b.Face.RecognitionDistance
+		}
+		return a.area() > b.area()
+	})
+}
+
+/*
+StickySelector
+Description: keeps the current target while it was seen within
+STICKY_LOST_AFTER. The target is the same person when it was recognized,
+otherwise the face nearest its last bearing within STICKY_BEARING_TOLERANCE.
+Without a target in sight Fallback picks.
+*/
+type StickySelector struct {
+	Fallback TargetSelector
+}
+
+func (s StickySelector) Select(candidates []Candidate, selection Selection) Candidate {
+	if same := s.inSight(candidates, selection); len(same) > 0 {
+		current := selection.Current
+		return best(same, func(a Candidate, b Candidate) bool {
+			return angleBetween(a.Bearing(), current.Bearing) < angleBetween(b.Bearing(), current.Bearing)
+		})
+	}
+	return s.Fallback.Select(candidates, selection)
+}
+
+// Decided is true when the current target is in sight, the sticky policy keeps it whatever else comes in.
+func (s StickySelector) Decided(candidates []Candidate, selection Selection) bool {
+	return len(s.inSight(candidates, selection)) > 0
+}
+
+// inSight are the candidates that can be the current target, none once it has not been seen for STICKY_LOST_AFTER.
+func (s StickySelector) inSight(candidates []Candidate, selection Selection) []Candidate {
+	current := selection.Current
+	if current == nil || time.Since(current.SeenAt) > STICKY_LOST_AFTER {
+		return nil
+	}
+	var same []Candidate
+	for _, c := range candidates {
+		if current.PersonID != "" && current.PersonID != facerec.UNKNOWN_PERSON {
+			if c.Face.PersonID == current.PersonID {
+				same = append(same, c)
+			}
+		} else if angleBetween(c.Bearing(), current.Bearing) <= STICKY_BEARING_TOLERANCE {
+			same = append(same, c)
+		}
+	}
+	return same
+}
@@ -0,0 +1,99 @@
+package examples
+
+import (
+	"image"
+	"testing"
+	"time"
+
+	"shared/facerec"
+)
+
+// face is a candidate of the given size at bearing, seen at the given time.
+func face(bearing float64, size int, personID string, distance float64, seenAt time.Time) Candidate {
+	view := NewView("test", nil, 100, 0, seenAt)
+	return Candidate{View: view, Face: Detection{
+		Rect:                image.Rect(0, 0, size, size),
+		AngleX:              100 - bearing,
+		PersonID:            personID,
+		RecognitionDistance: distance,
+	}}
+}
+
+func TestSelectorsPick(t *testing.T) {
+	now := time.Now()
+	earlier := now.Add(-time.Second)
+	for _, c := range []struct {
+		name       string
+		policy     string
+		candidates []Candidate
+		selection  Selection
+		want       int
+	}{
+		{"largest", POLICY_LARGEST, []Candidate{face(90, 20, "", 0, now), face(100, 40, "", 0, now), face(110, 30, "", 0, now)}, Selection{}, 1},
+		{"largest tie keeps the first", POLICY_LARGEST, []Candidate{face(90, 40, "", 0, now), face(100, 40, "", 0, now)}, Selection{}, 0},
+		{"heading", POLICY_HEADING, []Candidate{face(10, 40, "", 0, now), face(80, 20, "", 0, now), face(200, 40, "", 0, now)}, Selection{Heading: 90}, 1},
+		{"heading across north", POLICY_HEADING, []Candidate{face(300, 40, "", 0, now), face(10, 20, "", 0, now)}, Selection{Heading: 350}, 1},
+		{"recent", POLICY_RECENT, []Candidate{face(90, 60, "", 0, earlier), face(100, 20, "", 0, now), face(110, 30, "", 0, now)}, Selection{}, 2},
+		{"identity prefers recognized", POLICY_IDENTITY, []Candidate{face(90, 60, facerec.UNKNOWN_PERSON, 0, now), face(100, 20, "1", 50, now), face(110, 30, "2", 30, now)}, Selection{}, 2},
+		{"identity falls back to largest", POLICY_IDENTITY, []Candidate{face(90, 20, facerec.UNKNOWN_PERSON, 0, now), face(100, 30, facerec.UNKNOWN_PERSON, 0, now)}, Selection{}, 1},
+		{"sticky keeps the person", POLICY_STICKY, []Candidate{face(90, 60, "1", 0, now), face(200, 20, "2", 0, now)},
+			Selection{Current: &Target{PersonID: "2", Bearing: 100, SeenAt: now}}, 1},
+		{"sticky holds until lost", POLICY_STICKY, []Candidate{face(90, 60, "1", 0, now), face(200, 20, "2", 0, now)},
+			Selection{Current: &Target{PersonID: "2", Bearing: 100, SeenAt: now.Add(-STICKY_LOST_AFTER + 500*time.Millisecond)}}, 1},
+		{"sticky expires", POLICY_STICKY, []Candidate{face(90, 60, "1", 0, now), face(200, 20, "2", 0, now)},
+			Selection{Current: &Target{PersonID: "2", Bearing: 100, SeenAt: now.Add(-STICKY_LOST_AFTER - 100*time.Millisecond)}}, 0},
+		{"sticky without a target", POLICY_STICKY, []Candidate{face(90, 20, "1", 0, now), face(200, 60, "2", 0, now)}, Selection{}, 1},
+		{"sticky bearing at the tolerance", POLICY_STICKY, []Candidate{face(100+STICKY_BEARING_TOLERANCE, 20, "", 0, now), face(200, 60, "", 0, now)},
+			Selection{Current: &Target{Bearing: 100, SeenAt: now}}, 0},
+		{"sticky bearing past the tolerance", POLICY_STICKY, []Candidate{face(100+STICKY_BEARING_TOLERANCE+0.5, 20, "", 0, now), face(200, 60, "", 0, now)},
+			Selection{Current: &Target{Bearing: 100, SeenAt: now}}, 1},
+		{"sticky nearest the last bearing", POLICY_STICKY, []Candidate{face(110, 60, "", 0, now), face(95, 20, "", 0, now)},
+			Selection{Current: &Target{Bearing: 100, SeenAt: now}}, 1},
+	} {
+		selector, err := NewTargetSelector(c.policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := selector.Select(c.candidates, c.selection)
+		if want := c.candidates[c.want]; got.Face != want.Face || got.View.id != want.View.id {
+			t.Errorf("%s: picked %+v, want candidate %d %+v", c.name, got.Face, c.want, want.Face)
+		}
+	}
+}
+
+func TestStickyDecided(t *testing.T) {
+	now := time.Now()
+	candidates := []Candidate{face(90, 60, "1", 0, now), face(200, 20, "2", 0, now)}
+	sticky, ok := targetSelectors[POLICY_STICKY].(DecidingSelector)
+	if !ok {
+		t.Fatal("sticky is not a DecidingSelector")
+	}
+	for _, c := range []struct {
+		name    string
+		current *Target
+		want    bool
+	}{
+		{"no target", nil, false},
+		{"target in sight", &Target{PersonID: "2", SeenAt: now}, true},
+		{"target not in sight", &Target{PersonID: "3", SeenAt: now}, false},
+		{"target lost", &Target{PersonID: "2", SeenAt: now.Add(-STICKY_LOST_AFTER - time.Second)}, false},
+	} {
+		if got := sticky.Decided(candidates, Selection{Current: c.current}); got != c.want {
+			t.Errorf("%s: decided %v, want %v", c.name, got, c.want)
+		}
+	}
+	if _, ok := targetSelectors[POLICY_LARGEST].(DecidingSelector); ok {
+		t.Error("largest claims to know its pick before the selection window")
+	}
+}
+
+func TestEveryPolicyIsRegistered(t *testing.T) {
+	for _, policy := range []string{POLICY_LARGEST, POLICY_HEADING, POLICY_RECENT, POLICY_IDENTITY, POLICY_STICKY} {
+		if _, err := NewTargetSelector(policy); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := NewTargetSelector("nearest"); err == nil {
+		t.Error("unknown policy accepted")
+	}
+}
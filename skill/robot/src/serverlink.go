@@ -0,0 +1,87 @@
+package examples
+
+import (
+	"mind/core/framework/log"
+	"net"
+	"sync"
+	"time"
+)
+
+const SERVER_QUEUE_SIZE = 64
+const SERVER_REDIAL_AFTER = time.Second * 5
+const SERVER_WRITE_TIMEOUT = time.Second * 2
+
+/*
+ServerLink
+Description: the skill's connection to the webserver's robot listener. Messages
+are queued and written by one goroutine, which dials when there is no
+connection and at most once every SERVER_REDIAL_AFTER. While the webserver is
+unreachable, or the queue is full, messages are dropped: everything sent here
+is a report that a later one replaces.
+*/
+type ServerLink struct {
+	dial      func() net.Conn
+	queue     chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewServerLink(dial func() net.Conn) *ServerLink {
+	return &ServerLink{
+		dial:  dial,
+		queue: make(chan []byte, SERVER_QUEUE_SIZE),
+		done:  make(chan struct{}),
+	}
+}
+
+// Send queues one message for the webserver, it returns false when the message was dropped.
+func (l *ServerLink) Send(msgType MessageType, payload interface{}) bool {
+	data, err := EncodeMessage(msgType, payload, time.Now())
+	if err != nil {
+		log.Error.Println("could not encode ", msgType, " message: ", err)
+		return false
+	}
+	select {
+	case l.queue <- append(data, '\n'):
+		return true
+	default:
+		return false
+	}
+}
+
+// Run connects and writes queued messages until Close.
+func (l *ServerLink) Run() {
+	dialedAt := time.Now()
+	conn := l.dial()
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+	for {
+		select {
+		case <-l.done:
+			return
+		case line := <-l.queue:
+			if conn == nil {
+				if time.Since(dialedAt) < SERVER_REDIAL_AFTER {
+					break
+				}
+				dialedAt = time.Now()
+				if conn = l.dial(); conn == nil {
+					break
+				}
+			}
+			conn.SetWriteDeadline(time.Now().Add(SERVER_WRITE_TIMEOUT))
+			if _, err := conn.Write(line); err != nil {
+				log.Error.Println("lost the server: ", err)
+				conn.Close()
+				conn = nil
+			}
+		}
+	}
+}
+
+func (l *ServerLink) Close() {
+	l.closeOnce.Do(func() { close(l.done) })
+}
@@ -0,0 +1,129 @@
+package examples
+
+import (
+	"math"
+	"time"
+)
+
+/*====================================================
+VISUAL SERVO
+Turns where the face sits in the frame into head yaw and
+pitch corrections, one update per frame, so the face stays
+centered while the robot walks.
+=====================================================*/
+
+const SERVO_PERIOD = time.Millisecond * 100
+const SERVO_MOVE_DURATION_IN_MS = 100
+const PITCH_LIMIT_IN_DEGREES = 40.0
+
+/*
+PIDParams
+Gains work on an error in degrees and produce a correction in degrees.
+Errors inside Deadband are ignored so the head does not jitter around center.
+MaxOutput caps a single correction, MaxRate caps how fast the head may turn (degrees/s).
+IntegralLimit bounds the accumulated error. A zero limit means no limit.
+*/
+type PIDParams struct {
+	Kp            float64 `json:"kp"`
+	Ki            float64 `json:"ki"`
+	Kd            float64 `json:"kd"`
+	Deadband      float64 `json:"deadband"`
+	MaxOutput     float64 `json:"maxOutput"`
+	MaxRate       float64 `json:"maxRate"`
+	IntegralLimit float64 `json:"integralLimit"`
+}
+
+func DefaultYawPID() PIDParams {
+	return PIDParams{Kp: 0.6, Ki: 0.05, Kd: 0.1, Deadband: 2, MaxOutput: 15, MaxRate: 90, IntegralLimit: 20}
+}
+
+func DefaultPitchPID() PIDParams {
+	return PIDParams{Kp: 0.5, Ki: 0, Kd: 0.05, Deadband: 3, MaxOutput: 10, MaxRate: 45, IntegralLimit: 10}
+}
+
+/* PID */
+type PID struct {
+	params    PIDParams
+	integral  float64
+	lastError float64
+	primed    bool
+}
+
+func NewPID(params PIDParams) *PID {
+	return &PID{params: params}
+}
+
+func (pid *PID) Reset() {
+	pid.integral = 0
+	pid.lastError = 0
+	pid.primed = false
+}
+
+// Update takes the current error and the time since the last update and returns the correction to apply.
+func (pid *PID) Update(err float64, dt time.Duration) float64 {
+	p := pid.params
+	secs := dt.Seconds()
+	if secs <= 0 {
+		secs = SERVO_PERIOD.Seconds()
+	}
+	if math.Abs(err) < p.Deadband {
+		pid.lastError = 0
+		pid.primed = true
+		return 0
+	}
+
+	pid.integral = limit(pid.integral+err*secs, p.IntegralLimit)
+	derivative := 0.0
+	if pid.primed {
+		derivative = (err - pid.lastError) / secs
+	}
+	pid.lastError = err
+	pid.primed = true
+
+	out := p.Kp*err + p.Ki*pid.integral + p.Kd*derivative
+	out = limit(out, p.MaxOutput)
+	if p.MaxRate > 0 {
+		out = limit(out, p.MaxRate*secs)
+	}
+	return out
+}
+
+/* VisualServo */
+type VisualServo struct {
+	yaw   *PID
+	pitch *PID
+	last  time.Time
+}
+
+func NewVisualServo(yaw PIDParams, pitch PIDParams) *VisualServo {
+	return &VisualServo{yaw: NewPID(yaw), pitch: NewPID(pitch)}
+}
+
+func (vs *VisualServo) Reset() {
+	vs.yaw.Reset()
+	vs.pitch.Reset()
+	vs.last = time.Time{}
+}
+
+/*
+Update
+Description: corrections that move the head towards the face.
+Head directions grow to the left and pitch grows upwards, while image
+x grows to the right and y grows down, hence the sign flips.
+*/
+func (vs *VisualServo) Update(face Detection, now time.Time) (yawCorrection float64, pitchCorrection float64) {
+	dt := SERVO_PERIOD
+	if !vs.last.IsZero() {
+		dt = now.Sub(vs.last)
+	}
+	vs.last = now
+	return vs.yaw.Update(-face.AngleX, dt), vs.pitch.Update(-face.AngleY, dt)
+}
+
+// limit clamps v to [-max, max], a max of 0 leaves v alone.
+func limit(v float64, max float64) float64 {
+	if max <= 0 {
+		return v
+	}
+	return math.Max(-max, math.Min(max, v))
+}
@@ -0,0 +1,54 @@
+package examples
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPIDUpdate(t *testing.T) {
+	type step struct {
+		err  float64
+		dt   time.Duration
+		want float64
+	}
+	period := SERVO_PERIOD
+	for _, c := range []struct {
+		name   string
+		params PIDParams
+		steps  []step
+	}{
+		{"inside the deadband", PIDParams{Kp: 1, Deadband: 2}, []step{{1.9, period, 0}, {-1.9, period, 0}, {0, period, 0}}},
+		{"at the deadband", PIDParams{Kp: 1, Deadband: 2}, []step{{2, period, 2}, {-2, period, -2}}},
+		{"no limits", PIDParams{Kp: 10}, []step{{5, period, 50}}},
+		{"output limit", PIDParams{Kp: 10, MaxOutput: 15}, []step{{5, period, 15}, {-5, period, -15}, {1, period, 10}}},
+		{"rate limit", PIDParams{Kp: 10, MaxRate: 90}, []step{{5, period, 9}, {-5, period / 2, -4.5}, {0.5, period, 5}}},
+		{"rate limit without dt", PIDParams{Kp: 10, MaxRate: 90}, []step{{5, 0, 9}}},
+		{"tighter of output and rate", PIDParams{Kp: 10, MaxOutput: 6, MaxRate: 90}, []step{{5, period, 6}, {5, 2 * period, 6}}},
+		// ten steps of 10 would make an integral of 10 without the limit, one step of -10 then still leaves it positive
+		{"integral limit", PIDParams{Ki: 1, IntegralLimit: 0.5}, []step{
+			{10, period, 0.5}, {10, period, 0.5}, {10, period, 0.5}, {10, period, 0.5}, {10, period, 0.5},
+			{10, period, 0.5}, {10, period, 0.5}, {10, period, 0.5}, {10, period, 0.5}, {10, period, 0.5},
+			{-10, period, -0.5},
+		}},
+		{"integral paused in the deadband", PIDParams{Ki: 1, Deadband: 2}, []step{{10, period, 1}, {1, period, 0}, {10, period, 2}}},
+		{"derivative after the first update", PIDParams{Kd: 1}, []step{{4, period, 0}, {6, period, 20}, {6, period, 0}}},
+	} {
+		pid := NewPID(c.params)
+		for i, s := range c.steps {
+			if got := pid.Update(s.err, s.dt); math.Abs(got-s.want) > 1e-9 {
+				t.Errorf("%s step %d: Update(%v, %v) = %v, want %v", c.name, i, s.err, s.dt, got, s.want)
+			}
+		}
+	}
+}
+
+func TestPIDReset(t *testing.T) {
+	pid := NewPID(PIDParams{Ki: 1, Kd: 1})
+	pid.Update(10, SERVO_PERIOD)
+	pid.Reset()
+	// no integral left over and no derivative against the error before the reset
+	if got := pid.Update(4, SERVO_PERIOD); math.Abs(got-0.4) > 1e-9 {
+		t.Errorf("first update after Reset = %v, want 0.4", got)
+	}
+}
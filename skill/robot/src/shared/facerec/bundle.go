@@ -0,0 +1,71 @@
+package facerec
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+/*====================================================
+MODEL BUNDLES
+The webserver publishes the recognizer, the cascade and the
+people the recognizer knows as one versioned bundle, and a
+manifest to poll for it. The skill downloads the bundle when
+the manifest's version changes and checks it against the
+manifest's sha256.
+=====================================================*/
+
+/* ModelBundle is what the webserver serves at /bundle */
+type ModelBundle struct {
+	Version    int64           `json:"version"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	Recognizer RecognizerModel `json:"recognizer"`
+	// Cascade names the entry of Cascades the face detector loads
+	Cascade  string            `json:"cascade"`
+	Cascades map[string]string `json:"cascades"`
+	// People maps every label of the recognizer to the person it is
+	People map[string]BundlePerson `json:"people"`
+}
+
+/* BundlePerson is the part of the webserver's Person a recognizer label stands for */
+type BundlePerson struct {
+	ID        string `json:"id"`
+	Firstname string `json:"firstname,omitempty"`
+	Lastname  string `json:"lastname,omitempty"`
+}
+
+/* BundleManifest describes the bundle as served, SHA256 is of the served bytes */
+type BundleManifest struct {
+	Version   int64     `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	SHA256    string    `json:"sha256"`
+	Size      int       `json:"size"`
+}
+
+func NewManifest(bundle ModelBundle, data []byte) BundleManifest {
+	sum := sha256.Sum256(data)
+	return BundleManifest{
+		Version:   bundle.Version,
+		CreatedAt: bundle.CreatedAt,
+		SHA256:    hex.EncodeToString(sum[:]),
+		Size:      len(data),
+	}
+}
+
+func (bundle ModelBundle) Validate() error {
+	if err := bundle.Recognizer.Validate(); err != nil {
+		return err
+	}
+	for name := range bundle.Cascades {
+		if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+			return fmt.Errorf("bundle cascade name %q is not a plain file name", name)
+		}
+	}
+	if bundle.Cascades[bundle.Cascade] == "" {
+		return fmt.Errorf("bundle has no cascade %q", bundle.Cascade)
+	}
+	return nil
+}
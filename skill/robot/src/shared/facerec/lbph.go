@@ -0,0 +1,257 @@
+// Package facerec is the face recognition the skill and the webserver share: the
+// LBPH recognizer and the model bundles the webserver publishes for robots.
+package facerec
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"time"
+)
+
+/*====================================================
+LBPH FACE RECOGNITION
+Local binary pattern histograms, the same method as OpenCV's
+LBPHFaceRecognizer, written out here because the contrib
+FaceRecognizer is only reachable from C++. The webserver
+normalizes enrolled faces and trains the model, the skill
+loads the model and predicts. Both sides must crop and
+normalize the same way or distances mean nothing, which is
+why they share this package.
+=====================================================*/
+
+const FACE_SAMPLE_SIZE = 100
+const LBP_GRID = 8
+const LBP_BINS = 59 // 58 uniform patterns and one bin for all the others
+const RECOGNIZER_MODEL_VERSION = 1
+
+// DEFAULT_RECOGNITION_THRESHOLD is the chi-square distance above which a face is unknown.
+// Per-cell histograms are normalized, so distances run from 0 to 2*LBP_GRID*LBP_GRID.
+const DEFAULT_RECOGNITION_THRESHOLD = 40.0
+
+// UNKNOWN_PERSON is the PersonID of a face that matches nobody enrolled.
+const UNKNOWN_PERSON = "unknown"
+
+// uniformLBP maps an 8 bit pattern to its histogram bin, patterns with more than
+// two 0/1 transitions around the circle all share the last bin.
+var uniformLBP = func() [256]uint8 {
+	var table [256]uint8
+	next := uint8(0)
+	for code := 0; code < 256; code++ {
+		transitions := 0
+		for i := uint(0); i < 8; i++ {
+			if (code>>i)&1 != (code>>((i+1)%8))&1 {
+				transitions++
+			}
+		}
+		if transitions <= 2 {
+			table[code] = next
+			next++
+		} else {
+			table[code] = LBP_BINS - 1
+		}
+	}
+	return table
+}()
+
+/* RecognizerSample is one enrolled face, reduced to its histogram */
+type RecognizerSample struct {
+	PersonID  string    `json:"personId"`
+	Histogram []float32 `json:"histogram"`
+}
+
+/* RecognizerModel is what training produces and what the webserver hands the robot */
+type RecognizerModel struct {
+	Version   int                `json:"version"`
+	Grid      int                `json:"grid"`
+	FaceSize  int                `json:"faceSize"`
+	Threshold float64            `json:"threshold"`
+	TrainedAt time.Time          `json:"trainedAt"`
+	Samples   []RecognizerSample `json:"samples"`
+}
+
+/* LabeledFace is a normalized face and who it is */
+type LabeledFace struct {
+	PersonID string
+	Face     *image.Gray
+}
+
+// TrainModel builds a model from normalized faces, faces whose distance to every sample is above threshold are unknown.
+func TrainModel(faces []LabeledFace, threshold float64) (RecognizerModel, error) {
+	if len(faces) == 0 {
+		return RecognizerModel{}, errors.New("no faces to train on")
+	}
+	model := RecognizerModel{
+		Version:   RECOGNIZER_MODEL_VERSION,
+		Grid:      LBP_GRID,
+		FaceSize:  FACE_SAMPLE_SIZE,
+		Threshold: threshold,
+		TrainedAt: time.Now().UTC(),
+		Samples:   make([]RecognizerSample, 0, len(faces)),
+	}
+	for _, face := range faces {
+		model.Samples = append(model.Samples, RecognizerSample{PersonID: face.PersonID, Histogram: lbpHistogram(face.Face, LBP_GRID)})
+	}
+	return model, nil
+}
+
+func (model RecognizerModel) Validate() error {
+	if model.Version != RECOGNIZER_MODEL_VERSION {
+		return fmt.Errorf("recognizer model version %d, want %d", model.Version, RECOGNIZER_MODEL_VERSION)
+	}
+	if model.Grid != LBP_GRID || model.FaceSize != FACE_SAMPLE_SIZE {
+		return fmt.Errorf("recognizer model is %dx%d cells of %dpx faces, want %dx%d of %dpx", model.Grid, model.Grid, model.FaceSize, LBP_GRID, LBP_GRID, FACE_SAMPLE_SIZE)
+	}
+	if len(model.Samples) == 0 {
+		return errors.New("recognizer model has no samples")
+	}
+	size := LBP_GRID * LBP_GRID * LBP_BINS
+	for i, sample := range model.Samples {
+		if len(sample.Histogram) != size {
+			return fmt.Errorf("recognizer sample %d has %d bins, want %d", i, len(sample.Histogram), size)
+		}
+	}
+	return nil
+}
+
+// People is how many different people the model knows.
+func (model RecognizerModel) People() int {
+	people := make(map[string]bool)
+	for _, sample := range model.Samples {
+		people[sample.PersonID] = true
+	}
+	return len(people)
+}
+
+// Recognition is the nearest enrolled face, PersonID is UNKNOWN_PERSON when it is further than the threshold.
+type Recognition struct {
+	PersonID string
+	Nearest  string
+	Distance float64
+}
+
+// Predict finds the enrolled face nearest to a normalized face.
+func (model RecognizerModel) Predict(face *image.Gray) Recognition {
+	result := Recognition{PersonID: UNKNOWN_PERSON, Distance: math.Inf(1)}
+	histogram := lbpHistogram(face, model.Grid)
+	for _, sample := range model.Samples {
+		if d := chiSquare(histogram, sample.Histogram); d < result.Distance {
+			result.Distance = d
+			result.Nearest = sample.PersonID
+		}
+	}
+	if result.Distance <= model.Threshold {
+		result.PersonID = result.Nearest
+	}
+	return result
+}
+
+// NormalizeFace crops rect out of img, converts it to gray, resizes it to
+// FACE_SAMPLE_SIZE square and equalizes its histogram.
+func NormalizeFace(img image.Image, rect image.Rectangle) *image.Gray {
+	rect = rect.Intersect(img.Bounds())
+	gray := image.NewGray(image.Rect(0, 0, FACE_SAMPLE_SIZE, FACE_SAMPLE_SIZE))
+	if rect.Empty() {
+		return gray
+	}
+	// bilinear resize straight from the source, sampling pixel centers
+	sx := float64(rect.Dx()) / FACE_SAMPLE_SIZE
+	sy := float64(rect.Dy()) / FACE_SAMPLE_SIZE
+	luma := func(x, y int) float64 {
+		if x >= rect.Max.X {
+			x = rect.Max.X - 1
+		}
+		if y >= rect.Max.Y {
+			y = rect.Max.Y - 1
+		}
+		r, g, b, _ := img.At(x, y).RGBA()
+		return (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 257
+	}
+	for y := 0; y < FACE_SAMPLE_SIZE; y++ {
+		fy := math.Max((float64(y)+0.5)*sy-0.5, 0)
+		y0 := int(fy)
+		wy := fy - float64(y0)
+		for x := 0; x < FACE_SAMPLE_SIZE; x++ {
+			fx := math.Max((float64(x)+0.5)*sx-0.5, 0)
+			x0 := int(fx)
+			wx := fx - float64(x0)
+			px, py := rect.Min.X+x0, rect.Min.Y+y0
+			v := (1-wy)*((1-wx)*luma(px, py)+wx*luma(px+1, py)) +
+				wy*((1-wx)*luma(px, py+1)+wx*luma(px+1, py+1))
+			gray.Pix[y*gray.Stride+x] = uint8(v + 0.5)
+		}
+	}
+	equalizeHistogram(gray)
+	return gray
+}
+
+// equalizeHistogram spreads the gray levels of img over 0-255 in place, like cvEqualizeHist.
+func equalizeHistogram(img *image.Gray) {
+	var hist [256]int
+	for _, v := range img.Pix {
+		hist[v]++
+	}
+	total := len(img.Pix)
+	var lut [256]uint8
+	cdf, cdfMin := 0, 0
+	for i, n := range hist {
+		if cdf == 0 {
+			cdfMin = n
+		}
+		cdf += n
+		if total > cdfMin {
+			lut[i] = uint8(float64(cdf-cdfMin) * 255 / float64(total-cdfMin))
+		}
+	}
+	for i, v := range img.Pix {
+		img.Pix[i] = lut[v]
+	}
+}
+
+// lbpHistogram splits img into grid x grid cells and concatenates the normalized uniform LBP histogram of each.
+func lbpHistogram(img *image.Gray, grid int) []float32 {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	hist := make([]float32, grid*grid*LBP_BINS)
+	counts := make([]int, grid*grid)
+	at := func(x, y int) uint8 {
+		return img.Pix[img.PixOffset(b.Min.X+x, b.Min.Y+y)]
+	}
+	// neighbors clockwise from the top left, bit 7 first
+	offsets := [8]image.Point{{-1, -1}, {0, -1}, {1, -1}, {1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}}
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			center := at(x, y)
+			code := 0
+			for i, o := range offsets {
+				if at(x+o.X, y+o.Y) >= center {
+					code |= 1 << uint(7-i)
+				}
+			}
+			cell := (y*grid/h)*grid + x*grid/w
+			hist[cell*LBP_BINS+int(uniformLBP[code])]++
+			counts[cell]++
+		}
+	}
+	for cell, n := range counts {
+		if n == 0 {
+			continue
+		}
+		for i := cell * LBP_BINS; i < (cell+1)*LBP_BINS; i++ {
+			hist[i] /= float32(n)
+		}
+	}
+	return hist
+}
+
+func chiSquare(a []float32, b []float32) float64 {
+	sum := 0.0
+	for i := range a {
+		if s := float64(a[i]) + float64(b[i]); s > 0 {
+			d := float64(a[i]) - float64(b[i])
+			sum += d * d / s
+		}
+	}
+	return sum
+}
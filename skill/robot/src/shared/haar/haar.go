@@ -0,0 +1,86 @@
+// Package haar runs OpenCV haar cascades for the skill's and the webserver's face detectors.
+package haar
+
+/*
+#cgo linux pkg-config: opencv
+#include <stdlib.h>
+#include <opencv/cv.h>
+*/
+import "C"
+
+import (
+	"errors"
+	"image"
+	"unsafe"
+
+	"github.com/lazywei/go-opencv/opencv"
+)
+
+/*====================================================
+HAAR CASCADE
+go-opencv's HaarCascade.DetectObjects hardcodes the detection
+parameters and hands back rects that point into released
+storage, so the detector talks to the C API directly.
+=====================================================*/
+
+/* Params are cvHaarDetectObjects' parameters, a zero size means no limit */
+type Params struct {
+	ScaleFactor  float64
+	MinNeighbors int
+	MinSize      int
+	MaxSize      int
+}
+
+type Cascade struct {
+	cascade *C.CvHaarClassifierCascade
+}
+
+/* Hit is one detection, Neighbors is how many raw windows were merged into it */
+type Hit struct {
+	Rect      image.Rectangle
+	Neighbors int
+}
+
+func Load(path string) (*Cascade, error) {
+	cpath := C.CString(path)
+	defer C.free(unsafe.Pointer(cpath))
+	cascade := (*C.CvHaarClassifierCascade)(C.cvLoad(cpath, nil, nil, nil))
+	if cascade == nil {
+		return nil, errors.New("could not load haar cascade " + path)
+	}
+	return &Cascade{cascade: cascade}, nil
+}
+
+// Detect is not safe to call concurrently on the same cascade, OpenCV keeps per-image state in it.
+func (c *Cascade) Detect(img *opencv.IplImage, params Params) []Hit {
+	storage := C.cvCreateMemStorage(0)
+	defer C.cvReleaseMemStorage(&storage)
+
+	seq := C.cvHaarDetectObjects(
+		unsafe.Pointer(img),
+		c.cascade,
+		storage,
+		C.double(params.ScaleFactor),
+		C.int(params.MinNeighbors),
+		C.CV_HAAR_DO_CANNY_PRUNING,
+		C.cvSize(C.int(params.MinSize), C.int(params.MinSize)),
+		C.cvSize(C.int(params.MaxSize), C.int(params.MaxSize)),
+	)
+	if seq == nil {
+		return nil
+	}
+	hits := make([]Hit, 0, int(seq.total))
+	for i := 0; i < int(seq.total); i++ {
+		comp := (*C.CvAvgComp)(unsafe.Pointer(C.cvGetSeqElem(seq, C.int(i))))
+		r := comp.rect
+		hits = append(hits, Hit{
+			Rect:      image.Rect(int(r.x), int(r.y), int(r.x+r.width), int(r.y+r.height)),
+			Neighbors: int(comp.neighbors),
+		})
+	}
+	return hits
+}
+
+func (c *Cascade) Release() {
+	C.cvReleaseHaarClassifierCascade(&c.cascade)
+}
@@ -0,0 +1,241 @@
+package examples
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sort"
+	"sync"
+)
+
+/*====================================================
+SIMULATOR
+A virtual room that implements Body, Camera and RangeSensor
+so the follow pipeline can run without a robot:
+
+	sim := NewSimulator()
+	sim.AddFace(70, 3000)
+	FS := NewFollowSkill(sim, sim, sim)
+
+Directions are degrees in the room frame, counter clockwise
+like the head, distances are mm. Faces are at standing height,
+so at the default pitch of 20 degrees a face closer than about
+1.7m is above the top of the frame.
+The robot starts at the origin and walks without turning,
+like the hexabody does.
+=====================================================*/
+
+const SIM_IMAGE_WIDTH = 1280
+const SIM_IMAGE_HEIGHT = 720
+const SIM_WALK_SPEED_MM_PER_SECOND = 200.0
+const SIM_FACE_ABOVE_FLOOR_MM = 1500.0
+const SIM_CAMERA_ABOVE_FLOOR_MM = 150.0
+const SIM_RANGE_SENSOR_CONE_IN_DEGREES = 15.0
+const SIM_RANGE_SENSOR_MAX_MM = 4000.0
+
+var simBackground = color.RGBA{90, 90, 100, 255}
+var simSkin = color.RGBA{224, 172, 140, 255}
+var simFeature = color.RGBA{40, 30, 30, 255}
+
+/* SimFace is a face standing at a fixed point in the room */
+type SimFace struct {
+	X float64
+	Y float64
+}
+
+type Simulator struct {
+	mu            sync.Mutex
+	width         int
+	height        int
+	fieldOfView   float64
+	walkSpeed     float64
+	x             float64
+	y             float64
+	headDirection float64
+	pitch         float64
+	faces         []SimFace
+}
+
+func NewSimulator() *Simulator {
+	return &Simulator{
+		width:       SIM_IMAGE_WIDTH,
+		height:      SIM_IMAGE_HEIGHT,
+		fieldOfView: CAMERA_FIELD_OF_VIEW_IN_DEGREES,
+		walkSpeed:   SIM_WALK_SPEED_MM_PER_SECOND,
+	}
+}
+
+// AddFace places a face at the given bearing and distance from the robot's starting point and returns its index.
+func (sim *Simulator) AddFace(bearing float64, distance float64) int {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	rad := bearing * math.Pi / 180
+	sim.faces = append(sim.faces, SimFace{X: distance * math.Cos(rad), Y: distance * math.Sin(rad)})
+	return len(sim.faces) - 1
+}
+
+// MoveFace moves an existing face, used to script a walking target.
+func (sim *Simulator) MoveFace(index int, x float64, y float64) error {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	if index < 0 || index >= len(sim.faces) {
+		return fmt.Errorf("no simulated face %d", index)
+	}
+	sim.faces[index] = SimFace{X: x, Y: y}
+	return nil
+}
+
+// Target reports where a face is relative to the robot: the bearing error from the head direction and the distance.
+func (sim *Simulator) Target(index int) (bearingError float64, distance float64, err error) {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	if index < 0 || index >= len(sim.faces) {
+		return 0, 0, fmt.Errorf("no simulated face %d", index)
+	}
+	bearing, distance := sim.polar(sim.faces[index])
+	return normalizeAngle(bearing - sim.headDirection), distance, nil
+}
+
+func (sim *Simulator) Position() (x float64, y float64) {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	return sim.x, sim.y
+}
+
+/* Body */
+
+func (sim *Simulator) Start() error { return nil }
+func (sim *Simulator) Close()       {}
+func (sim *Simulator) Stand() error { return nil }
+
+func (sim *Simulator) MoveHead(direction float64, duration int) error {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	sim.headDirection = math.Mod(math.Mod(direction, 360)+360, 360)
+	return nil
+}
+
+func (sim *Simulator) Pitch(angle float64, duration int) error {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	sim.pitch = angle
+	return nil
+}
+
+func (sim *Simulator) StopPitch() {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	sim.pitch = 0
+}
+
+func (sim *Simulator) Walk(direction float64, duration int) error {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	step := sim.walkSpeed * float64(duration) / 1000
+	rad := direction * math.Pi / 180
+	sim.x += step * math.Cos(rad)
+	sim.y += step * math.Sin(rad)
+	return nil
+}
+
+func (sim *Simulator) StopWalkingContinuously() {}
+
+func (sim *Simulator) Direction() float64 {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	return sim.headDirection
+}
+
+/* Camera */
+
+// SnapshotRGBA renders every face inside the field of view of the head, far faces first so near ones cover them.
+func (sim *Simulator) SnapshotRGBA() *image.RGBA {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	img := image.NewRGBA(image.Rect(0, 0, sim.width, sim.height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{simBackground}, image.ZP, draw.Src)
+
+	faces := make([]SimFace, len(sim.faces))
+	copy(faces, sim.faces)
+	sort.Slice(faces, func(i, j int) bool {
+		_, di := sim.polar(faces[i])
+		_, dj := sim.polar(faces[j])
+		return di > dj
+	})
+
+	focal := float64(sim.width) / 2 / math.Tan(sim.fieldOfView/2*math.Pi/180)
+	for _, face := range faces {
+		bearing, distance := sim.polar(face)
+		offset := normalizeAngle(bearing - sim.headDirection)
+		if math.Abs(offset) >= sim.fieldOfView/2 || distance <= 0 {
+			continue
+		}
+		elevation := math.Atan2(SIM_FACE_ABOVE_FLOOR_MM-SIM_CAMERA_ABOVE_FLOOR_MM, distance) - sim.pitch*math.Pi/180
+		// head directions grow to the left, so larger bearings land left of center
+		cx := float64(sim.width)/2 - focal*math.Tan(offset*math.Pi/180)
+		cy := float64(sim.height)/2 - focal*math.Tan(elevation)
+		size := focal * AVERAGE_FACE_WIDTH_IN_MM / distance
+		drawSimFace(img, cx, cy, size)
+	}
+	return img
+}
+
+/* RangeSensor */
+
+// Value returns the distance to the nearest face in the sensor cone, or the max range when nothing is there.
+func (sim *Simulator) Value() (float64, error) {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	nearest := SIM_RANGE_SENSOR_MAX_MM
+	for _, face := range sim.faces {
+		bearing, distance := sim.polar(face)
+		if math.Abs(normalizeAngle(bearing-sim.headDirection)) <= SIM_RANGE_SENSOR_CONE_IN_DEGREES && distance < nearest {
+			nearest = distance
+		}
+	}
+	return nearest, nil
+}
+
+/* Helpers */
+
+func (sim *Simulator) polar(face SimFace) (bearing float64, distance float64) {
+	dx, dy := face.X-sim.x, face.Y-sim.y
+	return math.Atan2(dy, dx) * 180 / math.Pi, math.Hypot(dx, dy)
+}
+
+// normalizeAngle maps an angle in degrees onto (-180, 180].
+func normalizeAngle(angle float64) float64 {
+	angle = math.Mod(angle, 360)
+	if angle > 180 {
+		angle -= 360
+	} else if angle <= -180 {
+		angle += 360
+	}
+	return angle
+}
+
+// drawSimFace draws a plain frontal face: skin oval, two eyes and a mouth.
+func drawSimFace(img *image.RGBA, cx float64, cy float64, width float64) {
+	height := width * 1.3
+	fillEllipse(img, cx, cy, width/2, height/2, simSkin)
+	fillEllipse(img, cx-width*0.2, cy-height*0.12, width*0.08, width*0.05, simFeature)
+	fillEllipse(img, cx+width*0.2, cy-height*0.12, width*0.08, width*0.05, simFeature)
+	fillEllipse(img, cx, cy+height*0.22, width*0.2, width*0.04, simFeature)
+}
+
+func fillEllipse(img *image.RGBA, cx float64, cy float64, rx float64, ry float64, c color.RGBA) {
+	if rx <= 0 || ry <= 0 {
+		return
+	}
+	bounds := image.Rect(int(cx-rx), int(cy-ry), int(cx+rx)+1, int(cy+ry)+1).Intersect(img.Bounds())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			dx, dy := (float64(x)-cx)/rx, (float64(y)-cy)/ry
+			if dx*dx+dy*dy <= 1 {
+				img.SetRGBA(x, y, c)
+			}
+		}
+	}
+}
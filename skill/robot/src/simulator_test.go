@@ -0,0 +1,201 @@
+package examples
+
+import (
+	"context"
+	"image"
+	"math"
+	"testing"
+	"time"
+)
+
+// tests run from src, the skill runs from the directory above it
+const TEST_CASCADE_PATH = "../assets/haarcascade_frontalface_alt.xml"
+
+// skinBounds is the box around every skin colored pixel of a simulator frame.
+func skinBounds(img *image.RGBA) image.Rectangle {
+	var bounds image.Rectangle
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if img.RGBAAt(x, y) == simSkin {
+				bounds = bounds.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	return bounds
+}
+
+func lookAtFace(sim *Simulator, bearing float64, distance float64, head float64) *image.RGBA {
+	sim.AddFace(bearing, distance)
+	sim.MoveHead(head, 0)
+	sim.Pitch(GROUND_TO_FACE_PITCH_ANGLE, 0)
+	return sim.SnapshotRGBA()
+}
+
+func TestSimulatorDrawsDocumentedFaceInFrame(t *testing.T) {
+	sim := NewSimulator()
+	img := lookAtFace(sim, 70, 3000, 70)
+	face := skinBounds(img)
+	if face.Empty() || !face.In(img.Bounds()) {
+		t.Fatalf("face at %v is not inside the %v frame", face, img.Bounds())
+	}
+	if center := (face.Min.X + face.Max.X) / 2; math.Abs(float64(center-SIM_IMAGE_WIDTH/2)) > 1 {
+		t.Errorf("face straight ahead is centered at x=%d, want %d", center, SIM_IMAGE_WIDTH/2)
+	}
+}
+
+func TestSimulatorFaceBelowTopOfFrameUntilClose(t *testing.T) {
+	for _, c := range []struct {
+		distance float64
+		visible  bool
+	}{
+		{3000, true},
+		{2000, true},
+		{1500, false},
+	} {
+		img := lookAtFace(NewSimulator(), 90, c.distance, 90)
+		if visible := !skinBounds(img).Empty(); visible != c.visible {
+			t.Errorf("face at %vmm visible = %v, want %v", c.distance, visible, c.visible)
+		}
+	}
+}
+
+// A face left of the head, at a larger direction, has to show up left of center, and NewDetection has to give its bearing back.
+func TestSimulatorYawMatchesDetectionBearing(t *testing.T) {
+	for _, bearing := range []float64{80, 90, 100} {
+		sim := NewSimulator()
+		img := lookAtFace(sim, bearing, 3000, 90)
+		face := skinBounds(img)
+		center := (face.Min.X + face.Max.X) / 2
+		switch {
+		case bearing > 90 && center >= SIM_IMAGE_WIDTH/2:
+			t.Errorf("face at %v is right of center, x=%d", bearing, center)
+		case bearing < 90 && center <= SIM_IMAGE_WIDTH/2:
+			t.Errorf("face at %v is left of center, x=%d", bearing, center)
+		}
+		got := NewDetection(face, img.Bounds(), 0, 0).Bearing(sim.Direction())
+		if math.Abs(normalizeAngle(got-bearing)) > 0.5 {
+			t.Errorf("face at %v detected at bearing %v", bearing, got)
+		}
+	}
+}
+
+func TestSimulatorUnknownFace(t *testing.T) {
+	sim := NewSimulator()
+	sim.AddFace(0, 1000)
+	if err := sim.MoveFace(1, 0, 0); err == nil {
+		t.Error("MoveFace(1) with one face did not fail")
+	}
+	if _, _, err := sim.Target(-1); err == nil {
+		t.Error("Target(-1) did not fail")
+	}
+	if err := sim.MoveFace(0, 500, 0); err != nil {
+		t.Fatal(err)
+	}
+	if bearingError, distance, err := sim.Target(0); err != nil || bearingError != 0 || distance != 500 {
+		t.Errorf("Target(0) = %v, %v, %v, want 0, 500, nil", bearingError, distance, err)
+	}
+}
+
+// The drawn face has to be something the real cascade finds, or the simulator can't test detection.
+func TestHaarFindsSimulatedFace(t *testing.T) {
+	detector, err := NewFaceDetector(TEST_CASCADE_PATH, 1, DefaultDetectorParams())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer detector.Close()
+	sim := NewSimulator()
+	img := lookAtFace(sim, 95, 3000, 90)
+	faces, err := detector.Detect(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(faces) != 1 {
+		t.Fatalf("found %d faces, want 1", len(faces))
+	}
+	if !faces[0].Rect.Overlaps(skinBounds(img)) {
+		t.Errorf("face found at %v, drawn at %v", faces[0].Rect, skinBounds(img))
+	}
+	if bearing := faces[0].Bearing(sim.Direction()); math.Abs(normalizeAngle(bearing-95)) > 2 {
+		t.Errorf("face found at bearing %v, want 95", bearing)
+	}
+}
+
+/*
+TestFollowConverges
+Description: runs the whole pipeline against the simulator, from the sweep
+to walking up to the face, and passes once the head points at the face and
+the robot stands inside the standoff band.
+*/
+func TestFollowConverges(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs the follow pipeline for several seconds")
+	}
+	sim := NewSimulator()
+	sim.walkSpeed = 1000
+	face := sim.AddFace(70, 2500)
+	FS := NewFollowSkill(sim, sim, sim)
+	cfg := FS.Config()
+	cfg.CascadePath = TEST_CASCADE_PATH
+	cfg.SettleDelayMs = 0
+	if err := FS.SetConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer FS.faceDetector().Close()
+
+	FS.FollowAsync(context.Background())
+	defer FS.Stop()
+	band := cfg.Standoff.Distance + cfg.Standoff.Hysteresis
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+		bearingError, distance, err := sim.Target(face)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if FS.state.Is(StateFollowing) && math.Abs(bearingError) < cfg.YawPID.Deadband+1 && distance < band {
+			return
+		}
+	}
+	bearingError, distance, _ := sim.Target(face)
+	t.Fatalf("did not converge: state %s, bearing error %.1f, distance %.0fmm, want under %.0fmm",
+		FS.state.Current(), bearingError, distance, band)
+}
+
+// A sweep that sees no face ends lost, and following again searches again.
+func TestFollowLostWithoutFace(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs a whole sweep")
+	}
+	sim := NewSimulator()
+	FS := NewFollowSkill(sim, sim, sim)
+	cfg := FS.Config()
+	cfg.CascadePath = TEST_CASCADE_PATH
+	cfg.SettleDelayMs = 0
+	if err := FS.SetConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer FS.faceDetector().Close()
+
+	FS.FollowAsync(context.Background())
+	defer FS.Stop()
+	deadline := time.Now().Add(30 * time.Second)
+	for !FS.state.Is(StateLost) {
+		if time.Now().After(deadline) {
+			t.Fatalf("state %s after a sweep without faces, want lost", FS.state.Current())
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// following again while lost sweeps again
+	transitions := FS.state.Subscribe(8)
+	FS.FollowAsync(context.Background())
+	select {
+	case tr := <-transitions:
+		if tr.To != StateSearching {
+			t.Errorf("lost went to %s, want searching", tr.To)
+		}
+	case <-time.After(time.Second):
+		t.Error("following again while lost did not search")
+	}
+}
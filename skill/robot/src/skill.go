@@ -1,51 +1,105 @@
 package examples
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"math"
-	"mind/core/framework/drivers/distance"
-	"mind/core/framework/drivers/hexabody"
-	"mind/core/framework/drivers/media"
 	"mind/core/framework/log"
 	"mind/core/framework/skill"
 	"net"
 	"os"
 	"strconv"
+	"sync"
 	"time"
 
-	"github.com/lazywei/go-opencv/opencv"
+	"shared/facerec"
 )
 
 const ALL_VIEWS_BUFFER_SIZE = 1000
 const VIEW_EXPIRATION_IN_SECONDS = 300
 const SIZE_OF_INTERVAL_IN_DEGREES = 60.0
-const INTERVALS = 360 / SIZE_OF_INTERVAL_IN_DEGREES
 const TIME_TO_COMPLETE_MOVEMENT = 200
 const TIME_TO_SLEEP_AFTER_MOVEMENT_IN_MS = time.Millisecond * 200
 const GROUND_TO_FACE_PITCH_ANGLE = 20.0
+const LOST_FACE_FRAMES = 5
 
 type FollowSkill struct {
 	skill.Base
-	state           FollowState
-	stop            chan bool
-	allViews        chan View
-	viewsWithFaces  chan View
+	body            Body
+	camera          Camera
+	rangeSensor     RangeSensor
+	configMu        sync.Mutex
+	configUpdateMu  sync.Mutex
+	config          Config
+	detector        Detector
+	recognizer      *facerec.RecognizerModel
+	uplink          *Uplink
+	server          *ServerLink
+	sightingsMu     sync.Mutex
+	lastSightings   map[string]time.Time
+	preview         preview
+	bundle          bundleState
+	state           *StateMachine
+	mu              sync.Mutex
+	cancel          context.CancelFunc
+	done            chan struct{}
+	searchAgain     func()
+	workers         sync.WaitGroup
 	adjustView      chan View
+	targetMu        sync.Mutex
 	targetDirection float64
+	targetPerson    string
+	targetSeenAt    time.Time
+	target          *Target
 }
 
 func NewSkill() skill.Interface {
-	return &FollowSkill{
-		state:           FollowState{"idle"},
-		stop:            make(chan bool),
-		allViews:        make(chan View, ALL_VIEWS_BUFFER_SIZE),
-		viewsWithFaces:  make(chan View),
+	return NewFollowSkill(MindBody{}, MindCamera{}, MindRangeSensor{})
+}
+
+// NewFollowSkill builds the skill on top of the given hardware, NewSkill uses the mind drivers.
+func NewFollowSkill(body Body, camera Camera, rangeSensor RangeSensor) *FollowSkill {
+	config, err := LoadConfig(CONFIG_PATH)
+	if err != nil {
+		log.Error.Println(err)
+	}
+	detector, err := NewDetector(config)
+	if err != nil {
+		log.Error.Println(err)
+	}
+	recognizer, err := LoadRecognizer(config.RecognizerPath)
+	if err != nil {
+		log.Error.Println(err)
+	}
+	FS := &FollowSkill{
+		body:            body,
+		camera:          camera,
+		rangeSensor:     rangeSensor,
+		config:          config,
+		detector:        detector,
+		recognizer:      recognizer,
+		uplink:          NewUplink(config.Uplink),
+		lastSightings:   make(map[string]time.Time),
+		bundle:          bundleState{stop: make(chan struct{})},
+		state:           NewStateMachine(StateIdle, followTransitions),
 		adjustView:      make(chan View),
 		targetDirection: 0,
 	}
+	FS.server = NewServerLink(FS.connectToServer)
+	FS.hookStates()
+	return FS
 }
 
-type FollowState struct {
-	currState string
+// hookStates stops the body in every state that has it standing still and reports every state change to the remote.
+func (FS *FollowSkill) hookStates() {
+	stopWalking := func(t Transition) { FS.body.StopWalkingContinuously() }
+	for _, state := range []State{StateReacquiring, StateLost, StateStopped} {
+		FS.state.OnEnter(state, stopWalking)
+	}
+	for state := range stateNames {
+		FS.state.OnEnter(state, ReportTransition)
+	}
 }
 
 /*====================================================
@@ -54,232 +108,539 @@ EVENTS
 
 func (FS *FollowSkill) OnStart() {
 	log.Info.Println("Started")
-	hexabody.Start()
-	if !media.Available() {
-		log.Error.Println("Media driver not available")
+	if err := FS.body.Start(); err != nil {
+		log.Error.Println("Body could not start: ", err)
+	}
+	if err := FS.camera.Start(); err != nil {
+		log.Error.Println("Camera could not start: ", err)
 		return
 	}
-	if err := media.Start(); err != nil {
-		log.Error.Println("Media driver could not start")
+	if err := FS.rangeSensor.Start(); err != nil {
+		log.Error.Println("Range sensor could not start: ", err)
+	}
+	if err := FS.LoadInstalledBundle(); err != nil {
+		log.Error.Println("installed bundle could not load: ", err)
 	}
-	connectToServer()
+	go FS.RunBundleUpdates()
+	go FS.uplink.ReportStats(FS.state.Current)
+	go FS.server.Run()
 }
 
 func (FS *FollowSkill) OnClose() {
-	hexabody.Close()
+	FS.Stop()
+	FS.StopPreview()
+	FS.CloseBundleUpdates()
+	FS.uplink.Close()
+	FS.server.Close()
+	if detector := FS.faceDetector(); detector != nil {
+		detector.Close()
+	}
+	FS.rangeSensor.Close()
+	FS.camera.Close()
+	FS.body.Close()
 }
 
 func (FS *FollowSkill) OnDisconnect() {
+	FS.Stop()
 	os.Exit(0) // Closes the process when remote disconnects
 }
 
 func (FS *FollowSkill) OnRecvString(data string) {
 	log.Info.Println(data)
-	switch data {
-	case "test":
-		sendDataToServer()
-		break
-	case "start":
-		break
-	case "stop":
-		FS.stop <- true
-		break
-	case "pic":
-		PitchTest()
-		break
-	case "spinAround":
-		go FS.FollowAsync()
-		break
+	cmd, err := ParseCommand(data)
+	if err != nil {
+		FS.SendReply(Reply{ID: cmd.ID, Command: cmd.Name, Error: err.Error()})
+		return
 	}
+	FS.SendReply(FS.HandleCommand(cmd))
 }
 
 /*====================================================
 End Events
 ====================================================*/
-func connectToServer() net.Conn {
-	conn, err := net.Dial("tcp", "10.0.0.85:8080")
+
+func (FS *FollowSkill) connectToServer() net.Conn {
+	cfg := FS.Config()
+	if cfg.ServerTLS.Enabled {
+		tlsConfig, err := cfg.ServerTLS.ClientConfig()
+		if err != nil {
+			log.Error.Println(err)
+			return nil
+		}
+		conn, err := tls.Dial("tcp", cfg.ServerAddress, tlsConfig)
+		if err != nil {
+			log.Error.Println(err)
+			return nil // a nil *tls.Conn would make a non-nil net.Conn
+		}
+		return conn
+	}
+	conn, err := net.Dial("tcp", cfg.ServerAddress)
 	if err != nil {
 		log.Error.Println(err)
-		// handle error
+		return nil
 	}
-	// fmt.Fprintf(conn, "GET / HTTP/1.0\r\n\r\n")
-	//status, err := bufio.NewReader(conn).ReadString('\n')
-	//log.Info.Println(status)
 	return conn
 }
 
-func sendDataToServer() {
-	conn := connectToServer()
-	conn.Write([]byte("test message" + "\n"))
-	conn.Close()
+func (FS *FollowSkill) sendDataToServer() error {
+	conn := FS.connectToServer()
+	if conn == nil {
+		return errors.New("could not connect to " + FS.Config().ServerAddress)
+	}
+	defer conn.Close()
+	_, err := conn.Write([]byte("test message" + "\n"))
+	return err
+}
+
+// ReportTransition sends a state change to the remote as a state message.
+func ReportTransition(t Transition) {
+	SendMessage(MessageState, StateChange{From: t.From.String(), To: t.To.String(), Reason: t.Reason})
 }
 
 /*
 LookAround
 State: working
-Description: turn head in 360 and take pictures which are pushed into the all views channel
+Description: turn head in 360 and take pictures which are pushed into the all views channel.
+When every picture of the sweep has been checked and none had a face to follow, the
+search is lost; start searches again.
 */
-func (FS *FollowSkill) LookAround() {
-	FS.state.currState = "searching"
+func (FS *FollowSkill) LookAround(ctx context.Context, allViews chan<- View) {
+	if err := FS.state.Transition(StateSearching, "look around"); err != nil {
+		return
+	}
+	cfg := FS.Config()
 	currentInterval := 0
+	sweep := NewSweep()
 
-	direction := LookAt2(0.0, GROUND_TO_FACE_PITCH_ANGLE) // start from same spot everytime
+	direction := FS.LookAt2(0.0, cfg.GroundToFacePitch) // start from same spot everytime
 	if direction == -1 {
 		log.Error.Println("look at failed")
+		FS.state.Transition(StateLost, "look at failed")
 		return
 	}
-	for FS.state.currState == "searching" {
+	for FS.state.Is(StateSearching) {
+		view := NewView("LookAround-"+strconv.Itoa(int(direction)), FS.TakePic(), direction, cfg.GroundToFacePitch, time.Now())
+		view.sweep = sweep
+		sweep.Add()
 		select {
-		case <-FS.stop:
-			log.Info.Println("stop received")
+		case <-ctx.Done():
+			log.Info.Println("stop received during look around")
+			return
+		case allViews <- view:
+		}
+
+		if currentInterval >= cfg.Intervals()-1 {
+			break
+		}
+		currentInterval = currentInterval + 1
+		direction = FS.LookAt2(cfg.IntervalDegrees*float64(currentInterval), cfg.GroundToFacePitch)
+		if direction == -1 {
+			log.Error.Println("look at failed")
 			break
-		default:
-			FS.allViews <- NewView("LookAround-"+strconv.Itoa(int(direction)), TakePic(), direction, GROUND_TO_FACE_PITCH_ANGLE, time.Now())
+		}
+	}
+	logger("LookAround Complete")
+	select {
+	case <-ctx.Done():
+		return
+	case <-sweep.Finish():
+	}
+	// every view is checked, nothing else leaves searching now
+	if FS.state.Is(StateSearching) {
+		FS.state.Transition(StateLost, "no face in sweep")
+	}
+}
 
-			if math.Mod(float64(currentInterval), float64(INTERVALS)) == (INTERVALS - 1) {
-				return
-			}
-			currentInterval = currentInterval + 1
-			direction = LookAt2(SIZE_OF_INTERVAL_IN_DEGREES*float64(currentInterval), GROUND_TO_FACE_PITCH_ANGLE)
-			if direction == -1 {
-				log.Error.Println("look at failed")
-				break
-			}
+/* Sweep counts the views of one LookAround that are still being checked for faces */
+type Sweep struct {
+	mu       sync.Mutex
+	pending  int
+	finished bool
+	checked  chan struct{}
+}
+
+func NewSweep() *Sweep {
+	return &Sweep{checked: make(chan struct{})}
+}
+
+func (sweep *Sweep) Add() {
+	sweep.mu.Lock()
+	defer sweep.mu.Unlock()
+	sweep.pending++
+}
+
+// Done marks a view as dropped, or as taken by ConfirmFaceFound. Views that are not part of a sweep have a nil one.
+func (sweep *Sweep) Done() {
+	if sweep == nil {
+		return
+	}
+	sweep.mu.Lock()
+	defer sweep.mu.Unlock()
+	sweep.pending--
+	if sweep.finished && sweep.pending == 0 {
+		close(sweep.checked)
+	}
+}
 
+// Finish is called after the last Add, the channel is closed once every view has been checked.
+func (sweep *Sweep) Finish() <-chan struct{} {
+	sweep.mu.Lock()
+	defer sweep.mu.Unlock()
+	if !sweep.finished {
+		sweep.finished = true
+		if sweep.pending == 0 {
+			close(sweep.checked)
 		}
 	}
-	logger("LookAround Complete")
-	return
+	return sweep.checked
 }
 
-func (FS *FollowSkill) ContainsFaceAsync(view View) {
+func (FS *FollowSkill) ContainsFaceAsync(ctx context.Context, view View, viewsWithFaces chan<- View) {
 	log.Info.Println("Time since captured: ", time.Now().Sub(view.timestamp))
-	var cvimg *opencv.IplImage
-	var faces []*opencv.Rect
-	if view.image == nil {
-		log.Error.Println("NO IMAGE")
+	if ctx.Err() != nil {
+		view.sweep.Done()
+		return
 	}
-	cvimg = opencv.FromImage(view.image)
-	if cvimg == nil {
-		log.Error.Println("NO CVIMG")
+	view.detections = FS.DetectFaces(view.image)
+	if len(view.detections) == 0 {
+		log.Info.Println("no faces found in ", view.id)
+		view.sweep.Done()
+		return
 	}
-
-	faces = opencv.LoadHaarClassifierCascade("assets/haarcascade_frontalface_alt.xml").DetectObjects(cvimg) //maybe cant be in go routine?
-	if len(faces) > 0 {
-		log.Info.Println("******Face found at ", "view: ", view.name+"-", view.direction)
-		SendImage(view.image)
-		FS.viewsWithFaces <- view
+	log.Info.Println("******Face found at ", "view: ", view.name+"-", view.direction)
+	FS.SendView(view)
+	if len(FS.targetCandidates(view)) == 0 {
+		log.Info.Println("no ", FS.TargetPerson(), " in ", view.id, ", only strangers")
+		view.sweep.Done()
+		return
+	}
+	select {
+	case <-ctx.Done():
+		view.sweep.Done()
+	case viewsWithFaces <- view:
+		// ConfirmFaceFound marks it done once it has left searching
 	}
-	log.Info.Println("no faces found in ", view.id)
 }
 
-func (FS *FollowSkill) FindFaces() {
+func (FS *FollowSkill) FindFaces(ctx context.Context, allViews <-chan View, viewsWithFaces chan<- View) {
 	for {
 		select {
-		case <-FS.stop:
+		case <-ctx.Done():
 			log.Info.Println("stop called during find faces")
 			return
-		case currentView := <-FS.allViews:
-			if int(time.Now().Sub(currentView.timestamp).Seconds()) > VIEW_EXPIRATION_IN_SECONDS {
+		case currentView := <-allViews:
+			if time.Now().Sub(currentView.timestamp) > FS.Config().ViewExpiration() {
 				log.Info.Println("too long since taken, image has expired")
+				currentView.sweep.Done()
 				break
 			}
 			cV := currentView
-			go func() {
-				FS.ContainsFaceAsync(cV)
-			}()
+			FS.spawn(func() {
+				FS.ContainsFaceAsync(ctx, cV, viewsWithFaces)
+			})
 		}
 	}
 }
 
-func (FS *FollowSkill) CheckPeripherals(view View) {
+func (FS *FollowSkill) CheckPeripherals(ctx context.Context, view View, allViews chan<- View, viewsWithFaces chan<- View) {
 	log.Info.Println("Adjusting direction")
-	if ContainsFace(look(view, 1).image) == true {
+	if FS.state.Transition(StateReacquiring, "face not confirmed") != nil {
+		return
+	}
+	// ConfirmFaceFound is the only reader of viewsWithFaces and is the caller, so hand the view over from another goroutine
+	handOver := func(found View) {
+		FS.spawn(func() {
+			select {
+			case <-ctx.Done():
+			case viewsWithFaces <- found:
+			}
+		})
+	}
+	left := FS.look(view, 1)
+	left.detections = FS.DetectFaces(left.image)
+	if len(FS.targetCandidates(left)) > 0 {
 		log.Info.Println("success on look left")
-		FS.viewsWithFaces <- look(view, 1)
-	} else if ContainsFace(look(view, -1).image) == true {
+		FS.SendView(left)
+		handOver(left)
+		return
+	}
+	right := FS.look(view, -1)
+	right.detections = FS.DetectFaces(right.image)
+	if len(FS.targetCandidates(right)) > 0 {
 		log.Info.Println("success on look right")
-		FS.viewsWithFaces <- look(view, -1)
+		FS.SendView(right)
+		handOver(right)
 	} else {
 		log.Info.Println("could not relocate face")
-		go FS.LookAround()
+		FS.spawn(func() { FS.LookAround(ctx, allViews) })
 	}
 }
 
-func (FS *FollowSkill) ConfirmFaceFound() {
+func (FS *FollowSkill) ConfirmFaceFound(ctx context.Context, allViews chan<- View, viewsWithFaces chan View) {
 	for {
 		select {
-		case <-FS.stop:
-			hexabody.StopWalkingContinuously()
+		case <-ctx.Done():
 			logger("stop called")
 			return
-		case viewWithFace := <-FS.viewsWithFaces:
-			log.Info.Println("looking at view: ", viewWithFace.id)
-			look(viewWithFace, 0)
-			log.Info.Println("calculated direction: ", viewWithFace.direction, " API direction: ", hexabody.Direction())
-			image := TakePicAndSend()
-			lastView := View{viewWithFace.id, "ConfirmFaceFound-" + strconv.Itoa(int(viewWithFace.direction)), image, viewWithFace.direction, viewWithFace.angle, time.Now()}
-			if ContainsFace(lastView.image) {
-				FS.state.currState = "following"
-				FS.targetDirection = lastView.direction
+		case viewWithFace := <-viewsWithFaces:
+			err := FS.state.Transition(StateConfirming, "face in "+viewWithFace.name)
+			viewWithFace.sweep.Done()
+			if err != nil {
+				break
+			}
+			selector, heading := FS.targetSelector(), FS.body.Direction()
+			views := []View{viewWithFace}
+			if !FS.targetDecided(selector, heading, viewWithFace) {
+				views = FS.moreViewsWithFaces(ctx, viewWithFace, viewsWithFaces)
+			}
+			target, ok := FS.findTarget(selector, heading, views...)
+			if !ok {
+				target = Candidate{View: viewWithFace}
+			}
+			log.Info.Println("looking at view: ", target.View.id, " of ", len(views))
+			direction := target.Bearing()
+			FS.LookAt2(direction, target.View.angle)
+			log.Info.Println("calculated direction: ", direction, " API direction: ", FS.body.Direction())
+			lastView := NewView("ConfirmFaceFound-"+strconv.Itoa(int(direction)), FS.TakePic(), direction, target.View.angle, time.Now())
+			lastView.detections = FS.DetectFaces(lastView.image)
+			FS.SendView(lastView)
+			if target, ok := FS.findTarget(selector, direction, lastView); ok {
+				FS.setTargetDirection(target.Bearing())
+				FS.state.Transition(StateFollowing, "face confirmed")
+				if personID := FS.TargetPerson(); personID != "" {
+					SendMessage(MessageTarget, TargetStatus{PersonID: personID, Status: TARGET_FOUND, LastSeenAt: unixMillis(lastView.timestamp)})
+				}
 				log.Info.Println("Success!")
 
 			} else {
-				FS.CheckPeripherals(lastView)
+				FS.CheckPeripherals(ctx, lastView, allViews, viewsWithFaces)
 			}
-			//os.Exit(0)
-			//hexabody.Walk(viewWithFace.direction, 5000)
-			//close channel if found? stop go routines to see if look at works
 		}
 	}
 }
 
-func (FS *FollowSkill) MoveToTarget() {
+// moreViewsWithFaces gathers the views with faces that come in within SELECTION_WINDOW of first, so the target policy chooses between them rather than the first detection to finish.
+// ConfirmFaceFound skips it when the policy has decided on a face in first.
+func (FS *FollowSkill) moreViewsWithFaces(ctx context.Context, first View, viewsWithFaces <-chan View) []View {
+	views := []View{first}
+	window := time.NewTimer(SELECTION_WINDOW)
+	defer window.Stop()
 	for {
 		select {
-		case <-FS.stop:
+		case <-ctx.Done():
+			return views
+		case <-window.C:
+			return views
+		case view := <-viewsWithFaces:
+			view.sweep.Done()
+			views = append(views, view)
+		}
+	}
+}
+
+/*
+MoveToTarget
+State: following
+Description: every frame, center the face in the image by correcting head yaw and pitch,
+then walk along the head direction to hold the standoff distance, backing away
+when the face is too close. When the face is missing for
+lostFaceFrames frames in a row, fall back to checking the peripherals.
+*/
+func (FS *FollowSkill) MoveToTarget(ctx context.Context, allViews chan<- View, viewsWithFaces chan<- View) {
+	var servo *VisualServo
+	var standoff *StandoffController
+	var selector TargetSelector
+	var cfg Config
+	ticker := time.NewTicker(SERVO_PERIOD)
+	defer ticker.Stop()
+	following := false
+	direction, pitch := 0.0, 0.0
+	misses := 0
+	for {
+		select {
+		case <-ctx.Done():
 			log.Info.Println("stop received")
 			return
+		case now := <-ticker.C:
+			if !FS.state.Is(StateFollowing) {
+				following = false
+				break
+			}
+			if !following {
+				following = true
+				cfg = FS.Config()
+				servo = NewVisualServo(cfg.YawPID, cfg.PitchPID)
+				standoff = NewStandoffController(cfg.Standoff)
+				selector = FS.targetSelector()
+				direction, pitch = FS.TargetDirection(), cfg.GroundToFacePitch
+				misses = 0
+			}
 
-		default:
-			switch {
-			case FS.state.currState == "following":
-				distance.Start()
-				dist, err := distance.Value()
-				if err != nil {
-					log.Info.Println("error reading distance")
+			view := NewView("MoveToTarget-"+strconv.Itoa(int(direction)), FS.TakePic(), direction, pitch, now)
+			view.detections = FS.DetectFaces(view.image)
+			FS.reportSightings(view)
+			target, ok := FS.findTarget(selector, direction, view)
+			if !ok {
+				misses++
+				if misses >= cfg.LostFaceFrames {
+					log.Info.Println("lost face while following")
+					FS.CheckPeripherals(ctx, view, allViews, viewsWithFaces)
 				}
-				distance.Close()
-				log.Info.Println(" distance: ", dist)
-				log.Info.Println("following ", FS.targetDirection)
-				hexabody.MoveHead(FS.targetDirection, 100)
-				hexabody.Walk(FS.targetDirection, 50)
 				break
-			default:
+			}
+			misses = 0
+			face := target.Face
+
+			yaw, tilt := servo.Update(face, now)
+			direction = math.Mod(direction+yaw+360, 360)
+			pitch = limit(pitch+tilt, PITCH_LIMIT_IN_DEGREES)
+			if yaw != 0 {
+				FS.body.MoveHead(direction, SERVO_MOVE_DURATION_IN_MS)
+			}
+			if tilt != 0 {
+				FS.body.Pitch(pitch, SERVO_MOVE_DURATION_IN_MS)
+			}
+			FS.setTargetDirection(direction)
+
+			reading, err := FS.rangeSensor.Value()
+			if err != nil {
+				log.Info.Println("error reading distance: ", err)
+			}
+			dist, ok := FuseDistance(reading, err, face, cfg.Standoff)
+			if !ok {
 				break
 			}
-			break
+			move := standoff.Update(dist)
+			log.Info.Println("following ", direction, " distance: ", dist, " ", move)
+			SendMessage(MessageTelemetry, Telemetry{
+				State:     StateFollowing.String(),
+				Direction: direction,
+				Pitch:     pitch,
+				Distance:  dist,
+				Move:      move.String(),
+			})
+			switch move {
+			case StandoffApproach:
+				FS.body.Walk(direction, WALK_STEP_DURATION_IN_MS)
+			case StandoffRetreat:
+				FS.body.Walk(math.Mod(direction+180, 360), WALK_STEP_DURATION_IN_MS)
+			}
 		}
 	}
 }
 
-//Follow Skill is the entry point for this file
-func (FS *FollowSkill) FollowAsync() {
+func (FS *FollowSkill) TargetDirection() float64 {
+	FS.targetMu.Lock()
+	defer FS.targetMu.Unlock()
+	return FS.targetDirection
+}
+
+func (FS *FollowSkill) setTargetDirection(direction float64) {
+	FS.targetMu.Lock()
+	defer FS.targetMu.Unlock()
+	FS.targetDirection = direction
+}
+
+/*
+FollowAsync
+Description: entry point for this file. Starts the search and follow workers, which run
+until ctx is cancelled or Stop is called. Calling it while a follow is running does nothing,
+unless the search was lost, then it sweeps again.
+*/
+func (FS *FollowSkill) FollowAsync(ctx context.Context) {
+	FS.FollowPersonAsync(ctx, "")
+}
+
+// FollowPersonAsync is FollowAsync for one enrolled person, or for anyone when personID is empty.
+func (FS *FollowSkill) FollowPersonAsync(ctx context.Context, personID string) {
 	if FS == nil {
 		log.Info.Println("no follow skill")
+		return
+	}
+	FS.mu.Lock()
+	defer FS.mu.Unlock()
+	if FS.done != nil {
+		if FS.searchAgain != nil && FS.state.Is(StateLost) && FS.TargetPerson() == personID {
+			FS.searchAgain()
+			return
+		}
+		log.Info.Println("already following")
+		return
 	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	FS.cancel = cancel
+	FS.done = done
+	// every run gets its own channels, workers of an earlier run may still hold theirs
+	allViews := make(chan View, FS.Config().ViewBufferSize)
+	viewsWithFaces := make(chan View)
+	FS.setTargetPerson(personID)
 
-	StartingDirection := hexabody.Direction()
+	if FS.state.Is(StateStopped) {
+		FS.state.Transition(StateIdle, "follow restarted")
+	}
+	StartingDirection := FS.body.Direction()
 	log.Info.Println("Current Direction: ", StartingDirection)
-	go FS.LookAround()
-	go FS.FindFaces()
-	go FS.ConfirmFaceFound()
-	go FS.MoveToTarget()
+	FS.searchAgain = func() { FS.spawn(func() { FS.LookAround(ctx, allViews) }) }
+	FS.searchAgain()
+	FS.spawn(func() { FS.FindFaces(ctx, allViews, viewsWithFaces) })
+	FS.spawn(func() { FS.ConfirmFaceFound(ctx, allViews, viewsWithFaces) })
+	FS.spawn(func() { FS.MoveToTarget(ctx, allViews, viewsWithFaces) })
+	if personID != "" {
+		started := time.Now()
+		FS.spawn(func() { FS.watchTarget(ctx, cancel, personID, started) })
+	}
+
+	// cancellation from the caller's ctx cleans up the same way Stop does
+	go func() {
+		<-ctx.Done()
+		// no workers are added once Wait has started
+		FS.mu.Lock()
+		FS.searchAgain = nil
+		FS.mu.Unlock()
+		FS.workers.Wait()
+		FS.park()
+		FS.mu.Lock()
+		if FS.done == done {
+			FS.cancel = nil
+			FS.done = nil
+		}
+		FS.mu.Unlock()
+		close(done)
+	}()
 	//search
 	//moveTowards
 	//maintainDistance
 }
 
+// Stop cancels every follow worker, waits until they have all exited and parks the body.
+func (FS *FollowSkill) Stop() {
+	FS.mu.Lock()
+	cancel, done := FS.cancel, FS.done
+	FS.mu.Unlock()
+	if cancel == nil {
+		FS.park()
+		return
+	}
+	cancel()
+	<-done
+}
+
+// spawn runs fn as a follow worker that Stop waits for.
+func (FS *FollowSkill) spawn(fn func()) {
+	FS.workers.Add(1)
+	go func() {
+		defer FS.workers.Done()
+		fn()
+	}()
+}
+
+// park stops pitching, returns the head to neutral and moves to stopped, which stops walking.
+func (FS *FollowSkill) park() {
+	FS.Reset()
+	FS.state.Transition(StateStopped, "stopped")
+}
+
 //Follow()
 ///AnalyzeSurroundings()
 ////CaptureSurroundings()
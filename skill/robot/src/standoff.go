@@ -0,0 +1,112 @@
+package examples
+
+import "math"
+
+/*====================================================
+STANDOFF
+Keeps the robot at a set distance from the face it follows,
+using the ultrasonic range and the face size estimate together.
+=====================================================*/
+
+const WALK_STEP_DURATION_IN_MS = 50
+
+/*
+StandoffParams
+Distance is the range to hold and Hysteresis how far it may drift before
+the robot moves again, both in mm. Readings outside [SensorMin, SensorMax]
+are treated as no reading. SensorWeight is how much the range sensor counts
+against the face size estimate when both agree; when they differ by more
+than MaxDisagreement (a fraction of the face estimate) the sensor is most
+likely seeing something other than the face, and the nearer value wins so
+the robot never walks into it.
+*/
+type StandoffParams struct {
+	Distance        float64 `json:"distance"`
+	Hysteresis      float64 `json:"hysteresis"`
+	SensorMin       float64 `json:"sensorMin"`
+	SensorMax       float64 `json:"sensorMax"`
+	SensorWeight    float64 `json:"sensorWeight"`
+	MaxDisagreement float64 `json:"maxDisagreement"`
+}
+
+func DefaultStandoffParams() StandoffParams {
+	return StandoffParams{
+		Distance:        1000,
+		Hysteresis:      200,
+		SensorMin:       40,
+		SensorMax:       4000,
+		SensorWeight:    0.7,
+		MaxDisagreement: 0.5,
+	}
+}
+
+// FuseDistance returns the best distance to the face from both sources, ok is false when neither has a reading.
+func FuseDistance(sensor float64, sensorErr error, face Detection, p StandoffParams) (distance float64, ok bool) {
+	sensorValid := sensorErr == nil && sensor >= p.SensorMin && sensor <= p.SensorMax
+	faceValid := face.Distance > 0
+	switch {
+	case sensorValid && faceValid:
+		if math.Abs(sensor-face.Distance) > p.MaxDisagreement*face.Distance {
+			return math.Min(sensor, face.Distance), true
+		}
+		return p.SensorWeight*sensor + (1-p.SensorWeight)*face.Distance, true
+	case sensorValid:
+		return sensor, true
+	case faceValid:
+		return face.Distance, true
+	}
+	return 0, false
+}
+
+type StandoffMove int
+
+const (
+	StandoffHold StandoffMove = iota
+	StandoffApproach
+	StandoffRetreat
+)
+
+func (m StandoffMove) String() string {
+	switch m {
+	case StandoffApproach:
+		return "approach"
+	case StandoffRetreat:
+		return "retreat"
+	}
+	return "hold"
+}
+
+/*
+StandoffController
+Description: starts approaching once the face is further than Distance+Hysteresis
+and keeps going until it is back at Distance, and the mirror image for retreating.
+Inside the band it holds whatever it was doing last, which stops the robot from
+shuffling back and forth around the set point.
+*/
+type StandoffController struct {
+	params StandoffParams
+	move   StandoffMove
+}
+
+func NewStandoffController(params StandoffParams) *StandoffController {
+	return &StandoffController{params: params}
+}
+
+func (sc *StandoffController) Reset() {
+	sc.move = StandoffHold
+}
+
+func (sc *StandoffController) Update(distance float64) StandoffMove {
+	p := sc.params
+	switch {
+	case distance > p.Distance+p.Hysteresis:
+		sc.move = StandoffApproach
+	case distance < p.Distance-p.Hysteresis:
+		sc.move = StandoffRetreat
+	case sc.move == StandoffApproach && distance <= p.Distance:
+		sc.move = StandoffHold
+	case sc.move == StandoffRetreat && distance >= p.Distance:
+		sc.move = StandoffHold
+	}
+	return sc.move
+}
@@ -0,0 +1,69 @@
+package examples
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFuseDistance(t *testing.T) {
+	p := DefaultStandoffParams()
+	sensorErr := errors.New("no echo")
+	for _, c := range []struct {
+		name   string
+		sensor float64
+		err    error
+		face   float64
+		want   float64
+		ok     bool
+	}{
+		{"both agree", 1000, nil, 1200, 0.7*1000 + 0.3*1200, true},
+		{"sensor much nearer", 300, nil, 1200, 300, true},
+		{"sensor much further", 3000, nil, 1200, 1200, true},
+		{"disagreement at the limit", 1800, nil, 1200, 0.7*1800 + 0.3*1200, true},
+		{"sensor error", 1000, sensorErr, 1200, 1200, true},
+		{"sensor below range", p.SensorMin - 1, nil, 1200, 1200, true},
+		{"sensor above range", p.SensorMax + 1, nil, 1200, 1200, true},
+		{"sensor at the range edge", p.SensorMin, nil, 0, p.SensorMin, true},
+		{"sensor only", 900, nil, 0, 900, true},
+		{"face only", 0, sensorErr, 1500, 1500, true},
+		{"neither", p.SensorMax + 1, nil, 0, 0, false},
+	} {
+		got, ok := FuseDistance(c.sensor, c.err, Detection{Distance: c.face}, p)
+		if ok != c.ok || got != c.want {
+			t.Errorf("%s: FuseDistance = %v, %v, want %v, %v", c.name, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestStandoffHysteresis(t *testing.T) {
+	p := DefaultStandoffParams() // hold 1000mm, give or take 200mm
+	sc := NewStandoffController(p)
+	for i, c := range []struct {
+		distance float64
+		want     StandoffMove
+	}{
+		{1000, StandoffHold},
+		{1200, StandoffHold},
+		{1201, StandoffApproach},
+		{1100, StandoffApproach},
+		{1001, StandoffApproach},
+		{1000, StandoffHold},
+		{1150, StandoffHold},
+		{800, StandoffHold},
+		{799, StandoffRetreat},
+		{900, StandoffRetreat},
+		{999, StandoffRetreat},
+		{1000, StandoffHold},
+		{1300, StandoffApproach},
+		{700, StandoffRetreat},
+		{1250, StandoffApproach},
+	} {
+		if got := sc.Update(c.distance); got != c.want {
+			t.Errorf("step %d: Update(%v) = %s, want %s", i, c.distance, got, c.want)
+		}
+	}
+	sc.Reset()
+	if got := sc.Update(1100); got != StandoffHold {
+		t.Errorf("Update(1100) after Reset = %s, want hold", got)
+	}
+}
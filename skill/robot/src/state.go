@@ -0,0 +1,202 @@
+package examples
+
+import (
+	"fmt"
+	"mind/core/framework/log"
+	"sync"
+	"time"
+)
+
+/*====================================================
+STATE MACHINE
+=====================================================*/
+
+type State int
+
+const (
+	StateIdle State = iota
+	StateSearching
+	StateConfirming
+	StateReacquiring
+	StateFollowing
+	StateLost
+	StateStopped
+)
+
+var stateNames = map[State]string{
+	StateIdle:        "idle",
+	StateSearching:   "searching",
+	StateConfirming:  "confirming",
+	StateReacquiring: "reacquiring",
+	StateFollowing:   "following",
+	StateLost:        "lost",
+	StateStopped:     "stopped",
+}
+
+func (s State) String() string {
+	if name, ok := stateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("state(%d)", int(s))
+}
+
+// followTransitions lists, for every state, the states the follow skill may move to next.
+var followTransitions = map[State][]State{
+	StateIdle:        {StateSearching, StateStopped},
+	StateSearching:   {StateConfirming, StateLost, StateStopped},
+	StateConfirming:  {StateFollowing, StateReacquiring, StateLost, StateStopped},
+	StateReacquiring: {StateConfirming, StateSearching, StateLost, StateStopped},
+	StateFollowing:   {StateReacquiring, StateLost, StateStopped},
+	StateLost:        {StateSearching, StateIdle, StateStopped},
+	StateStopped:     {StateIdle, StateSearching},
+}
+
+/* Transition */
+type Transition struct {
+	From   State
+	To     State
+	Reason string
+	At     time.Time
+}
+
+func (t Transition) String() string {
+	return t.From.String() + " -> " + t.To.String() + " (" + t.Reason + ")"
+}
+
+type TransitionHook func(t Transition)
+type TransitionGuard func(t Transition) error
+
+/* StateMachine */
+type StateMachine struct {
+	mu          sync.Mutex
+	current     State
+	table       map[State][]State
+	guards      map[State][]TransitionGuard
+	onEnter     map[State][]TransitionHook
+	onExit      map[State][]TransitionHook
+	subscribers []chan Transition
+}
+
+func NewStateMachine(initial State, table map[State][]State) *StateMachine {
+	return &StateMachine{
+		current: initial,
+		table:   table,
+		guards:  make(map[State][]TransitionGuard),
+		onEnter: make(map[State][]TransitionHook),
+		onExit:  make(map[State][]TransitionHook),
+	}
+}
+
+func (sm *StateMachine) Current() State {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return sm.current
+}
+
+// Is reports whether the machine is currently in any of the given states.
+func (sm *StateMachine) Is(states ...State) bool {
+	current := sm.Current()
+	for _, s := range states {
+		if s == current {
+			return true
+		}
+	}
+	return false
+}
+
+// Guard registers a check that can veto any transition into the given state.
+func (sm *StateMachine) Guard(to State, guard TransitionGuard) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.guards[to] = append(sm.guards[to], guard)
+}
+
+func (sm *StateMachine) OnEnter(state State, hook TransitionHook) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.onEnter[state] = append(sm.onEnter[state], hook)
+}
+
+func (sm *StateMachine) OnExit(state State, hook TransitionHook) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.onExit[state] = append(sm.onExit[state], hook)
+}
+
+// Subscribe returns a stream of every accepted transition. Slow readers miss transitions instead of blocking the machine.
+func (sm *StateMachine) Subscribe(buffer int) <-chan Transition {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	c := make(chan Transition, buffer)
+	sm.subscribers = append(sm.subscribers, c)
+	return c
+}
+
+/*
+Transition
+Description: move to the given state if the table allows it and no guard objects.
+Illegal transitions are logged and returned as an error, the state is left unchanged.
+Moving to the current state is a no-op. Guards and hooks run outside the lock, so
+they may read the machine and hooks may trigger further transitions; when the state
+changes while the guards run, the transition fails.
+*/
+func (sm *StateMachine) Transition(to State, reason string) error {
+	sm.mu.Lock()
+	t := Transition{From: sm.current, To: to, Reason: reason, At: time.Now()}
+	if t.From == to {
+		sm.mu.Unlock()
+		return nil
+	}
+	if !sm.allowed(t.From, to) {
+		sm.mu.Unlock()
+		err := fmt.Errorf("illegal transition %s", t)
+		log.Error.Println(err)
+		return err
+	}
+	guards := append([]TransitionGuard(nil), sm.guards[to]...)
+	sm.mu.Unlock()
+
+	for _, guard := range guards {
+		if err := guard(t); err != nil {
+			log.Error.Println("transition", t, "rejected:", err)
+			return err
+		}
+	}
+
+	sm.mu.Lock()
+	if sm.current != t.From {
+		current := sm.current
+		sm.mu.Unlock()
+		err := fmt.Errorf("transition %s dropped, the state changed to %s meanwhile", t, current)
+		log.Error.Println(err)
+		return err
+	}
+	sm.current = to
+	exitHooks := append([]TransitionHook(nil), sm.onExit[t.From]...)
+	enterHooks := append([]TransitionHook(nil), sm.onEnter[to]...)
+	for _, c := range sm.subscribers {
+		select {
+		case c <- t:
+		default:
+		}
+	}
+	sm.mu.Unlock()
+
+	log.Info.Println("state:", t)
+	for _, hook := range exitHooks {
+		hook(t)
+	}
+	for _, hook := range enterHooks {
+		hook(t)
+	}
+	return nil
+}
+
+func (sm *StateMachine) allowed(from State, to State) bool {
+	for _, s := range sm.table[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
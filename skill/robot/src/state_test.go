@@ -0,0 +1,99 @@
+package examples
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTransitionFollowsTable(t *testing.T) {
+	sm := NewStateMachine(StateIdle, followTransitions)
+	if err := sm.Transition(StateFollowing, "skip ahead"); err == nil {
+		t.Error("idle -> following was allowed")
+	}
+	for _, to := range []State{StateSearching, StateLost, StateSearching} {
+		if err := sm.Transition(to, "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if current := sm.Current(); current != StateSearching {
+		t.Errorf("state %s, want searching", current)
+	}
+}
+
+// The follow timeout ends a follow in whatever state it is in.
+func TestEveryFollowStateCanBeLost(t *testing.T) {
+	for _, from := range []State{StateSearching, StateConfirming, StateReacquiring, StateFollowing} {
+		sm := NewStateMachine(from, followTransitions)
+		if err := sm.Transition(StateLost, "timeout"); err != nil {
+			t.Errorf("%s -> lost: %v", from, err)
+		}
+	}
+}
+
+// A guard that reads the machine must not deadlock it.
+func TestGuardReadsMachine(t *testing.T) {
+	sm := NewStateMachine(StateIdle, followTransitions)
+	sm.Guard(StateSearching, func(tr Transition) error {
+		if sm.Current() != tr.From {
+			return errors.New("guard saw the state change early")
+		}
+		return nil
+	})
+	done := make(chan error, 1)
+	go func() { done <- sm.Transition(StateSearching, "test") }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("transition with a guard reading the machine did not return")
+	}
+}
+
+func TestGuardRejects(t *testing.T) {
+	sm := NewStateMachine(StateIdle, followTransitions)
+	sm.Guard(StateSearching, func(tr Transition) error { return errors.New("no") })
+	if err := sm.Transition(StateSearching, "test"); err == nil {
+		t.Error("guard did not reject")
+	}
+	if current := sm.Current(); current != StateIdle {
+		t.Errorf("state %s after rejection, want idle", current)
+	}
+}
+
+// stopCountingBody is the simulator counting the times the skill stops it walking.
+type stopCountingBody struct {
+	*Simulator
+	stops int32
+}
+
+func (b *stopCountingBody) StopWalkingContinuously() { atomic.AddInt32(&b.stops, 1) }
+
+func TestFollowStatesStopWalking(t *testing.T) {
+	sim := NewSimulator()
+	body := &stopCountingBody{Simulator: sim}
+	FS := NewFollowSkill(body, sim, sim)
+	defer FS.uplink.Close()
+	for _, step := range []struct {
+		to    State
+		stops int32
+	}{
+		{StateSearching, 0},
+		{StateConfirming, 0},
+		{StateFollowing, 0},
+		{StateReacquiring, 1},
+		{StateConfirming, 1},
+		{StateLost, 2},
+		{StateStopped, 3},
+	} {
+		if err := FS.state.Transition(step.to, "test"); err != nil {
+			t.Fatal(err)
+		}
+		if stops := atomic.LoadInt32(&body.stops); stops != step.stops {
+			t.Errorf("%s: stopped walking %d times, want %d", step.to, stops, step.stops)
+		}
+	}
+}
@@ -0,0 +1,392 @@
+package examples
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"mind/core/framework/log"
+	"sync"
+	"time"
+)
+
+/*====================================================
+UPLINK
+Frames for the remote go through a named stream instead of
+straight to framework.SendString. Each stream downscales,
+encodes at its own JPEG quality and sends at most MaxFPS
+frames a second. When frames come in faster than that and
+the queue is full, a stream with DropOldest drops its oldest
+queued frame, so the remote always gets the most recent
+picture; without it the new frame is dropped instead, so
+the frames that do go out are evenly spaced.
+=====================================================*/
+
+const STREAM_FRAMES = "frames"
+const STREAM_SNAPSHOTS = "snapshots"
+const STREAM_PREVIEW = "preview"
+const UPLINK_STATS_PERIOD = time.Second * 5
+
+// UPLINK_RATE_WINDOW is how far back BytesPerSecond looks.
+const UPLINK_RATE_WINDOW = UPLINK_STATS_PERIOD
+
+func init() {
+	RegisterCommand("uplink", func(FS *FollowSkill, args json.RawMessage) (interface{}, error) {
+		return FS.uplink.Stats(), nil
+	})
+}
+
+/* StreamConfig, a zero size or rate means no limit. DropOldest picks which frame a full queue drops */
+type StreamConfig struct {
+	MaxWidth   int     `json:"maxWidth"`
+	MaxHeight  int     `json:"maxHeight"`
+	Quality    int     `json:"quality"`
+	MaxFPS     float64 `json:"maxFps"`
+	QueueSize  int     `json:"queueSize"`
+	DropOldest bool    `json:"dropOldest"`
+}
+
+/* UplinkConfig has one StreamConfig per stream */
+type UplinkConfig struct {
+	Frames    StreamConfig `json:"frames"`
+	Snapshots StreamConfig `json:"snapshots"`
+	Preview   StreamConfig `json:"preview"`
+}
+
+func DefaultUplinkConfig() UplinkConfig {
+	return UplinkConfig{
+		Frames:    StreamConfig{MaxWidth: 640, MaxHeight: 360, Quality: 60, MaxFPS: 2, QueueSize: 4, DropOldest: true},
+		Snapshots: StreamConfig{MaxWidth: 1280, MaxHeight: 720, Quality: 85, MaxFPS: 1, QueueSize: 2, DropOldest: true},
+		Preview:   StreamConfig{MaxWidth: 480, MaxHeight: 270, Quality: 50, MaxFPS: 5, QueueSize: 1, DropOldest: true},
+	}
+}
+
+func (cfg UplinkConfig) streams() map[string]StreamConfig {
+	return map[string]StreamConfig{
+		STREAM_FRAMES:    cfg.Frames,
+		STREAM_SNAPSHOTS: cfg.Snapshots,
+		STREAM_PREVIEW:   cfg.Preview,
+	}
+}
+
+/* StreamStats are counted since the stream was created, BytesPerSecond over the last UPLINK_RATE_WINDOW */
+type StreamStats struct {
+	SentFrames     int64   `json:"sentFrames"`
+	DroppedFrames  int64   `json:"droppedFrames"`
+	SentBytes      int64   `json:"sentBytes"`
+	BytesPerSecond float64 `json:"bytesPerSecond"`
+}
+
+/* uplinkFrame is one queued view, its detections go out right after the image */
+type uplinkFrame struct {
+	view     View
+	annotate bool
+}
+
+type stream struct {
+	name     string
+	mu       sync.Mutex
+	cfg      StreamConfig
+	queue    []uplinkFrame
+	wake     chan struct{}
+	lastSent time.Time
+	stats    StreamStats
+	created  time.Time
+	recent   []sentSample
+}
+
+/* sentSample is one frame sent within UPLINK_RATE_WINDOW */
+type sentSample struct {
+	at    time.Time
+	bytes int64
+}
+
+type Uplink struct {
+	mu      sync.Mutex
+	streams map[string]*stream
+	send    func(msgType MessageType, payload interface{}) int
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func NewUplink(cfg UplinkConfig) *Uplink {
+	u := &Uplink{
+		streams: make(map[string]*stream),
+		send:    SendMessage,
+		done:    make(chan struct{}),
+	}
+	u.Configure(cfg)
+	return u
+}
+
+// Configure changes the settings of every stream, creating the ones that do not exist yet.
+func (u *Uplink) Configure(cfg UplinkConfig) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for name, streamCfg := range cfg.streams() {
+		if s, ok := u.streams[name]; ok {
+			s.mu.Lock()
+			s.cfg = streamCfg
+			s.mu.Unlock()
+			continue
+		}
+		s := &stream{name: name, cfg: streamCfg, wake: make(chan struct{}, 1), created: time.Now()}
+		u.streams[name] = s
+		u.wg.Add(1)
+		go u.run(s)
+	}
+}
+
+// Enqueue hands a view to the named stream. A full queue drops its oldest frame with DropOldest, otherwise view itself.
+func (u *Uplink) Enqueue(name string, view View, annotate bool) {
+	u.mu.Lock()
+	s, ok := u.streams[name]
+	u.mu.Unlock()
+	if !ok {
+		log.Error.Println("no uplink stream ", name)
+		return
+	}
+	s.mu.Lock()
+	size := s.cfg.QueueSize
+	if size < 1 {
+		size = 1
+	}
+	if len(s.queue) >= size && !s.cfg.DropOldest {
+		s.stats.DroppedFrames++
+		s.mu.Unlock()
+		return
+	}
+	for len(s.queue) >= size {
+		s.queue = s.queue[1:]
+		s.stats.DroppedFrames++
+	}
+	s.queue = append(s.queue, uplinkFrame{view: view, annotate: annotate})
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Stats returns the counters of every stream. Reading them changes nothing, any number of callers may poll.
+func (u *Uplink) Stats() map[string]StreamStats {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	stats := make(map[string]StreamStats, len(u.streams))
+	now := time.Now()
+	for name, s := range u.streams {
+		s.mu.Lock()
+		stats[name] = s.statsAt(now)
+		s.mu.Unlock()
+	}
+	return stats
+}
+
+// statsAt is the stream's counters with BytesPerSecond over the window before now, the caller holds s.mu.
+func (s *stream) statsAt(now time.Time) StreamStats {
+	stats := s.stats
+	since := now.Add(-UPLINK_RATE_WINDOW)
+	if s.created.After(since) {
+		since = s.created
+	}
+	var bytes int64
+	for _, sample := range s.recent {
+		if sample.at.After(since) {
+			bytes += sample.bytes
+		}
+	}
+	if elapsed := now.Sub(since).Seconds(); elapsed > 0 {
+		stats.BytesPerSecond = float64(bytes) / elapsed
+	}
+	return stats
+}
+
+// recordSent counts a sent frame and forgets the ones that fell out of the window, the caller holds s.mu.
+func (s *stream) recordSent(at time.Time, bytes int64) {
+	s.stats.SentFrames++
+	s.stats.SentBytes += bytes
+	since := at.Add(-UPLINK_RATE_WINDOW)
+	for len(s.recent) > 0 && !s.recent[0].at.After(since) {
+		s.recent = s.recent[1:]
+	}
+	s.recent = append(s.recent, sentSample{at: at, bytes: bytes})
+}
+
+// ReportStats sends the stream counters as telemetry every UPLINK_STATS_PERIOD until the uplink is closed.
+func (u *Uplink) ReportStats(state func() State) {
+	ticker := time.NewTicker(UPLINK_STATS_PERIOD)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-u.done:
+			return
+		case <-ticker.C:
+			values := make(map[string]float64)
+			for name, s := range u.Stats() {
+				values["uplink."+name+".sentFrames"] = float64(s.SentFrames)
+				values["uplink."+name+".droppedFrames"] = float64(s.DroppedFrames)
+				values["uplink."+name+".bytesPerSecond"] = s.BytesPerSecond
+			}
+			u.send(MessageTelemetry, Telemetry{State: state().String(), Values: values})
+		}
+	}
+}
+
+func (u *Uplink) Close() {
+	select {
+	case <-u.done:
+		return
+	default:
+	}
+	close(u.done)
+	u.wg.Wait()
+}
+
+// run sends the frames of one stream, waiting between frames to stay under MaxFPS.
+func (u *Uplink) run(s *stream) {
+	defer u.wg.Done()
+	for {
+		select {
+		case <-u.done:
+			return
+		case <-s.wake:
+		}
+		for {
+			s.mu.Lock()
+			if len(s.queue) == 0 {
+				s.mu.Unlock()
+				break
+			}
+			var wait time.Duration
+			if s.cfg.MaxFPS > 0 {
+				wait = s.lastSent.Add(time.Duration(float64(time.Second) / s.cfg.MaxFPS)).Sub(time.Now())
+			}
+			s.mu.Unlock()
+			if wait > 0 {
+				select {
+				case <-u.done:
+					return
+				case <-time.After(wait):
+				}
+			}
+
+			s.mu.Lock()
+			if len(s.queue) == 0 {
+				s.mu.Unlock()
+				break
+			}
+			frame := s.queue[0]
+			s.queue = s.queue[1:]
+			cfg := s.cfg
+			s.lastSent = time.Now()
+			s.mu.Unlock()
+
+			sent := u.sendFrame(s.name, frame, cfg)
+			s.mu.Lock()
+			if sent > 0 {
+				s.recordSent(time.Now(), int64(sent))
+			} else {
+				s.stats.DroppedFrames++
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// sendFrame sends the image and then its detections, returning the bytes sent or 0 on failure.
+func (u *Uplink) sendFrame(name string, frame uplinkFrame, cfg StreamConfig) int {
+	view := frame.view
+	if view.image == nil {
+		return 0
+	}
+	img := view.image
+	if frame.annotate {
+		img = Annotate(img, view.detections)
+	}
+	data, size, err := encodeFrame(img, cfg)
+	if err != nil {
+		log.Error.Println("could not encode image: ", err)
+		return 0
+	}
+	sent := u.send(MessageImage, ImageFrame{
+		FrameID:    view.id,
+		Stream:     name,
+		Format:     "jpeg",
+		Width:      size.Dx(),
+		Height:     size.Dy(),
+		Direction:  view.direction,
+		Pitch:      view.angle,
+		CapturedAt: unixMillis(view.timestamp),
+		Annotated:  frame.annotate,
+		Data:       base64.StdEncoding.EncodeToString(data),
+	})
+	if sent == 0 {
+		return 0
+	}
+	return sent + u.send(MessageDetections, NewDetectionOverlay(view))
+}
+
+// encodeFrame downscales img to the stream's size and encodes it at the stream's quality.
+func encodeFrame(img *image.RGBA, cfg StreamConfig) ([]byte, image.Rectangle, error) {
+	img = downscale(img, cfg.MaxWidth, cfg.MaxHeight)
+	options := &jpeg.Options{Quality: jpeg.DefaultQuality}
+	if cfg.Quality > 0 {
+		options.Quality = cfg.Quality
+	}
+	buf := new(bytes.Buffer)
+	if err := jpeg.Encode(buf, img, options); err != nil {
+		return nil, image.Rectangle{}, err
+	}
+	return buf.Bytes(), img.Bounds(), nil
+}
+
+// downscale shrinks img to fit in maxWidth x maxHeight keeping its aspect ratio, averaging the source pixels.
+func downscale(img *image.RGBA, maxWidth int, maxHeight int) *image.RGBA {
+	b := img.Bounds()
+	scale := 1.0
+	if maxWidth > 0 && b.Dx() > maxWidth {
+		scale = float64(maxWidth) / float64(b.Dx())
+	}
+	if maxHeight > 0 && float64(b.Dy())*scale > float64(maxHeight) {
+		scale = float64(maxHeight) / float64(b.Dy())
+	}
+	if scale >= 1 {
+		return img
+	}
+	w, h := int(float64(b.Dx())*scale), int(float64(b.Dy())*scale)
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := b.Min.Y+y*b.Dy()/h, b.Min.Y+(y+1)*b.Dy()/h
+		for x := 0; x < w; x++ {
+			x0, x1 := b.Min.X+x*b.Dx()/w, b.Min.X+(x+1)*b.Dx()/w
+			var r, g, bl, a, n int
+			for sy := y0; sy < y1; sy++ {
+				i := img.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += int(img.Pix[i])
+					g += int(img.Pix[i+1])
+					bl += int(img.Pix[i+2])
+					a += int(img.Pix[i+3])
+					i += 4
+					n++
+				}
+			}
+			if n == 0 {
+				continue
+			}
+			o := out.PixOffset(x, y)
+			out.Pix[o] = uint8(r / n)
+			out.Pix[o+1] = uint8(g / n)
+			out.Pix[o+2] = uint8(bl / n)
+			out.Pix[o+3] = uint8(a / n)
+		}
+	}
+	return out
+}
@@ -0,0 +1,58 @@
+package examples
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStreamStatsAreRepeatable(t *testing.T) {
+	now := time.Now()
+	s := &stream{created: now.Add(-time.Minute)}
+	s.recordSent(now.Add(-UPLINK_RATE_WINDOW-time.Second), 1000) // outside the window
+	s.recordSent(now.Add(-time.Second), 2000)
+	s.recordSent(now, 3000)
+
+	first, second := s.statsAt(now), s.statsAt(now)
+	if first != second {
+		t.Errorf("second read %+v differs from the first %+v", second, first)
+	}
+	if want := 5000 / UPLINK_RATE_WINDOW.Seconds(); first.BytesPerSecond != want {
+		t.Errorf("bytesPerSecond = %v, want %v", first.BytesPerSecond, want)
+	}
+	if first.SentFrames != 3 || first.SentBytes != 6000 {
+		t.Errorf("sent %d frames, %d bytes, want 3, 6000", first.SentFrames, first.SentBytes)
+	}
+}
+
+func TestNewStreamRateUsesItsAge(t *testing.T) {
+	now := time.Now()
+	s := &stream{created: now.Add(-time.Second)}
+	s.recordSent(now, 500)
+	if rate := s.statsAt(now).BytesPerSecond; rate != 500 {
+		t.Errorf("bytesPerSecond = %v one second after creation, want 500", rate)
+	}
+}
+
+func TestEnqueueDropPolicy(t *testing.T) {
+	for _, c := range []struct {
+		dropOldest bool
+		want       []string
+	}{
+		{true, []string{"b", "c"}},
+		{false, []string{"a", "b"}},
+	} {
+		s := &stream{name: "test", cfg: StreamConfig{QueueSize: 2, DropOldest: c.dropOldest}, wake: make(chan struct{}, 1)}
+		u := &Uplink{streams: map[string]*stream{"test": s}}
+		for _, name := range []string{"a", "b", "c"} {
+			u.Enqueue("test", NewView(name, nil, 0, 0, time.Now()), false)
+		}
+		var queued []string
+		for _, frame := range s.queue {
+			queued = append(queued, frame.view.name)
+		}
+		if !reflect.DeepEqual(queued, c.want) || s.stats.DroppedFrames != 1 {
+			t.Errorf("dropOldest %v: queued %v with %d dropped, want %v with 1", c.dropOldest, queued, s.stats.DroppedFrames, c.want)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const MAX_UPLOAD_BYTES = 10 << 20
+
+var faceDetector *FaceDetector
+
+// What POST /analyze answers with
+type AnalyzeResult struct {
+	Width            int            `json:"width"`
+	Height           int            `json:"height"`
+	Format           string         `json:"format"`
+	Faces            []Face         `json:"faces"`
+	Params           DetectorParams `json:"params"`
+	ProcessingTimeMs float64        `json:"processingTimeMs"`
+}
+
+// JSON body alternative to an upload, image is base64 and may be a data: URL
+type AnalyzeRequest struct {
+	Image  string          `json:"image"`
+	Params *DetectorParams `json:"params,omitempty"`
+}
+
+// Run face detection on an uploaded JPEG or PNG. The image can come as
+// multipart/form-data (field "image"), as a raw image/jpeg or image/png body,
+// or as an AnalyzeRequest JSON body. Detector params default to the skill's
+// and can be overridden with scaleFactor, minNeighbors, minSize and maxSize
+// query parameters. Once the recognizer is trained every face also gets a personId.
+func analyzeImage(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	if faceDetector == nil {
+		writeError(w, http.StatusServiceUnavailable, "face detector not loaded")
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, MAX_UPLOAD_BYTES)
+
+	params, err := detectorParamsFromQuery(r, DefaultDetectorParams())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	data, bodyParams, status, err := readImage(r)
+	if err != nil {
+		writeError(w, status, err.Error())
+		return
+	}
+	if bodyParams != nil {
+		params = *bodyParams
+	}
+	if err := params.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		writeError(w, http.StatusUnsupportedMediaType, "could not decode image: "+err.Error())
+		return
+	}
+	faces, err := faceDetector.Detect(img, params)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	recognizer.Recognize(img, faces)
+	writeJSON(w, http.StatusOK, AnalyzeResult{
+		Width:            img.Bounds().Dx(),
+		Height:           img.Bounds().Dy(),
+		Format:           format,
+		Faces:            faces,
+		Params:           params,
+		ProcessingTimeMs: float64(time.Since(start)) / float64(time.Millisecond),
+	})
+}
+
+// readImage returns the encoded image bytes from whichever body format the request used
+func readImage(r *http.Request) ([]byte, *DetectorParams, int, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, nil, http.StatusUnsupportedMediaType, errors.New("missing or invalid Content-Type")
+	}
+	switch {
+	case mediaType == "multipart/form-data":
+		file, _, err := r.FormFile("image")
+		if err != nil {
+			return nil, nil, http.StatusBadRequest, fmt.Errorf("form field image: %v", err)
+		}
+		defer file.Close()
+		data, err := ioutil.ReadAll(file)
+		if err != nil {
+			return nil, nil, http.StatusBadRequest, err
+		}
+		return data, nil, http.StatusOK, nil
+	case mediaType == "application/json":
+		var req AnalyzeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return nil, nil, http.StatusBadRequest, fmt.Errorf("invalid JSON body: %v", err)
+		}
+		encoded := req.Image
+		if strings.HasPrefix(encoded, "data:") {
+			if comma := strings.Index(encoded, ","); comma >= 0 {
+				encoded = encoded[comma+1:]
+			}
+		}
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, nil, http.StatusBadRequest, fmt.Errorf("image is not base64: %v", err)
+		}
+		return data, req.Params, http.StatusOK, nil
+	case mediaType == "image/jpeg" || mediaType == "image/png":
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, nil, http.StatusBadRequest, err
+		}
+		return data, nil, http.StatusOK, nil
+	}
+	return nil, nil, http.StatusUnsupportedMediaType, fmt.Errorf("unsupported Content-Type %s", mediaType)
+}
+
+func detectorParamsFromQuery(r *http.Request, params DetectorParams) (DetectorParams, error) {
+	query := r.URL.Query()
+	if v := query.Get("scaleFactor"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return params, fmt.Errorf("scaleFactor: %v", err)
+		}
+		params.ScaleFactor = f
+	}
+	for name, field := range map[string]*int{
+		"minNeighbors": &params.MinNeighbors,
+		"minSize":      &params.MinSize,
+		"maxSize":      &params.MaxSize,
+	} {
+		if v := query.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return params, fmt.Errorf("%s: %v", name, err)
+			}
+			*field = n
+		}
+	}
+	return params, nil
+}
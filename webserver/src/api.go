@@ -1,14 +1,26 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"net"
+	"mime"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
+	"shared/facerec"
 )
 
 // The person Type (more like an object)
@@ -23,83 +35,426 @@ type Address struct {
 	State string `json:"state,omitempty"`
 }
 
-var people []Person
+var store PersonStore
 
-// Display all from the people var
+// How long running requests and robot handlers get to finish on SIGINT/SIGTERM
+const SHUTDOWN_TIMEOUT = 10 * time.Second
+
+const DEFAULT_PAGE_LIMIT = 100
+const MAX_PAGE_LIMIT = 1000
+const MAX_FIELD_LENGTH = 100
+
+var validID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Every error the API returns has this body
+type APIError struct {
+	Status int    `json:"status"`
+	Error  string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, APIError{Status: status, Error: msg})
+}
+
+// writeStoreError maps the store's errors to status codes
+func writeStoreError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrPersonNotFound:
+		writeError(w, http.StatusNotFound, err.Error())
+	case ErrPersonExists:
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		log.Println("people store:", err)
+		writeError(w, http.StatusInternalServerError, "could not access people")
+	}
+}
+
+func (p Person) Validate() error {
+	if !validID.MatchString(p.ID) {
+		return errors.New("id must be 1-64 letters, digits, _ or -")
+	}
+	if p.ID == facerec.UNKNOWN_PERSON {
+		return errors.New("id " + facerec.UNKNOWN_PERSON + " is reserved for faces the recognizer does not know")
+	}
+	if strings.TrimSpace(p.Firstname) == "" && strings.TrimSpace(p.Lastname) == "" {
+		return errors.New("firstname or lastname is required")
+	}
+	fields := map[string]string{"firstname": p.Firstname, "lastname": p.Lastname}
+	if p.Address != nil {
+		fields["address.city"] = p.Address.City
+		fields["address.state"] = p.Address.State
+	}
+	for name, value := range fields {
+		if len(value) > MAX_FIELD_LENGTH {
+			return fmt.Errorf("%s is longer than %d characters", name, MAX_FIELD_LENGTH)
+		}
+	}
+	return nil
+}
+
+// decodeBody reads a JSON request body into v, rejecting other content types and unknown fields.
+// PATCH bodies may also be application/merge-patch+json.
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || (mediaType != "application/json" && !(r.Method == http.MethodPatch && mediaType == "application/merge-patch+json")) {
+			writeError(w, http.StatusUnsupportedMediaType, "body must be application/json")
+			return false
+		}
+	}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// matches is the name/city filter of GetPeople, both case insensitive; name matches
+// first, last or full name, city the whole city
+func (p Person) matches(name string, city string) bool {
+	if name != "" {
+		name = strings.ToLower(name)
+		full := strings.ToLower(p.Firstname + " " + p.Lastname)
+		if !strings.Contains(full, name) {
+			return false
+		}
+	}
+	if city != "" && (p.Address == nil || !strings.EqualFold(p.Address.City, city)) {
+		return false
+	}
+	return true
+}
+
+// List people, filtered by ?name= and ?city=, a page at a time with ?limit= and ?offset=.
+// The number of matches before paging is in the X-Total-Count header.
 func GetPeople(w http.ResponseWriter, r *http.Request) {
-	json.NewEncoder(w).Encode(people)
+	query := r.URL.Query()
+	limit, offset := DEFAULT_PAGE_LIMIT, 0
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MAX_PAGE_LIMIT {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be 1-%d", MAX_PAGE_LIMIT))
+			return
+		}
+		limit = n
+	}
+	if v := query.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "offset must be 0 or more")
+			return
+		}
+		offset = n
+	}
+
+	people, err := store.List()
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	matches := make([]Person, 0, len(people))
+	for _, person := range people {
+		if person.matches(query.Get("name"), query.Get("city")) {
+			matches = append(matches, person)
+		}
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(matches)))
+	if offset > len(matches) {
+		offset = len(matches)
+	}
+	end := offset + limit
+	if end > len(matches) {
+		end = len(matches)
+	}
+	writeJSON(w, http.StatusOK, matches[offset:end])
 }
 
 // Display a single data
 func GetPerson(w http.ResponseWriter, r *http.Request) {
-	params := mux.Vars(r)
-	for _, item := range people {
-		if item.ID == params["id"] {
-			json.NewEncoder(w).Encode(item)
+	person, err := store.Get(mux.Vars(r)["id"])
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, person)
+}
+
+// create a new item, the ID comes from the path or, for POST /people, the body
+func CreatePerson(w http.ResponseWriter, r *http.Request) {
+	var person Person
+	if !decodeBody(w, r, &person) {
+		return
+	}
+	if id, ok := mux.Vars(r)["id"]; ok {
+		if person.ID != "" && person.ID != id {
+			writeError(w, http.StatusBadRequest, "id in body does not match the path")
 			return
 		}
+		person.ID = id
 	}
-	json.NewEncoder(w).Encode(&Person{})
+	if err := person.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := store.Create(person); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/people/"+person.ID)
+	writeJSON(w, http.StatusCreated, person)
 }
 
-// create a new item
-func CreatePerson(w http.ResponseWriter, r *http.Request) {
-	params := mux.Vars(r)
+// Replace an item (PUT) or change only the fields in the body (PATCH). A PATCH body
+// is a JSON merge patch (RFC 7386): null removes a field, objects such as the address
+// are merged, anything else replaces the field.
+func UpdatePerson(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if r.Method == http.MethodPatch {
+		var patch interface{}
+		if !decodeBody(w, r, &patch) {
+			return
+		}
+		if _, ok := patch.(map[string]interface{}); !ok {
+			writeError(w, http.StatusBadRequest, "a merge patch must be a JSON object")
+			return
+		}
+		// the patch applies to the record as the store holds it, so concurrent patches don't lose each other
+		var invalid error
+		person, err := store.Modify(id, func(existing Person) (Person, error) {
+			person, err := patchPerson(existing, patch)
+			if err != nil {
+				invalid = errors.New("invalid patch: " + err.Error())
+			} else {
+				invalid = checkUpdate(id, &person)
+			}
+			return person, invalid
+		})
+		if invalid != nil {
+			writeError(w, http.StatusBadRequest, invalid.Error())
+		} else if err != nil {
+			writeStoreError(w, err)
+		} else {
+			writeJSON(w, http.StatusOK, person)
+		}
+		return
+	}
 	var person Person
-	_ = json.NewDecoder(r.Body).Decode(&person)
-	person.ID = params["id"]
-	people = append(people, person)
-	json.NewEncoder(w).Encode(people)
+	if !decodeBody(w, r, &person) {
+		return
+	}
+	if err := checkUpdate(id, &person); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := store.Update(person); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, person)
 }
 
-// Delete an item
-func DeletePerson(w http.ResponseWriter, r *http.Request) {
-	params := mux.Vars(r)
-	for index, item := range people {
-		if item.ID == params["id"] {
-			people = append(people[:index], people[index+1:]...)
-			break
+// checkUpdate gives person the ID from the path and validates it
+func checkUpdate(id string, person *Person) error {
+	if person.ID != "" && person.ID != id {
+		return errors.New("id in body does not match the path")
+	}
+	person.ID = id
+	return person.Validate()
+}
+
+// patchPerson applies a merge patch to person, rejecting fields a Person doesn't have
+func patchPerson(person Person, patch interface{}) (Person, error) {
+	data, err := json.Marshal(person)
+	if err != nil {
+		return person, err
+	}
+	var target interface{}
+	if err := json.Unmarshal(data, &target); err != nil {
+		return person, err
+	}
+	if data, err = json.Marshal(mergePatch(target, patch)); err != nil {
+		return person, err
+	}
+	var patched Person
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return patched, decoder.Decode(&patched)
+}
+
+// mergePatch is RFC 7386: objects merge key by key, null removes the key, anything else replaces target
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+		} else {
+			targetObject[key] = mergePatch(targetObject[key], value)
 		}
-		json.NewEncoder(w).Encode(people)
 	}
+	return targetObject
 }
 
-func analyzeImage(w http.ResponseWriter, r *http.Request) {
-	json.NewEncoder(w).Encode("test")
+// Delete an item and its face samples. The samples go first, so when that fails
+// the person is still there to delete again.
+func DeletePerson(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if _, err := store.Get(id); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if err := faceStore.DeletePerson(id); err != nil {
+		log.Println("deleting faces of", id, ":", err)
+		writeError(w, http.StatusInternalServerError, "could not delete the faces of "+id)
+		return
+	}
+	if err := store.Delete(id); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
 
-// main function to boot up everything
-func main() {
+// openStore opens the file store in dataDir, or a memory store when dataDir is empty,
+// and adds the example people to an empty store
+func openStore(dataDir string) (PersonStore, error) {
+	var s PersonStore = NewMemoryStore()
+	if dataDir != "" {
+		fileStore, err := OpenFileStore(dataDir)
+		if err != nil {
+			return nil, err
+		}
+		s = fileStore
+	}
+	people, err := s.List()
+	if err != nil || len(people) > 0 {
+		return s, err
+	}
+	s.Create(Person{ID: "1", Firstname: "John", Lastname: "Doe", Address: &Address{City: "City X", State: "State X"}})
+	s.Create(Person{ID: "2", Firstname: "Koko", Lastname: "Doe", Address: &Address{City: "City Z", State: "State Y"}})
+	return s, nil
+}
+
+// newRouter routes the REST API, every error, including unknown routes and methods, in the APIError shape
+func newRouter() *mux.Router {
 	router := mux.NewRouter()
-	people = append(people, Person{ID: "1", Firstname: "John", Lastname: "Doe", Address: &Address{City: "City X", State: "State X"}})
-	people = append(people, Person{ID: "2", Firstname: "Koko", Lastname: "Doe", Address: &Address{City: "City Z", State: "State Y"}})
+	router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "no route for "+r.Method+" "+r.URL.Path)
+	})
+	router.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusMethodNotAllowed, "method "+r.Method+" not allowed for "+r.URL.Path)
+	})
 	router.HandleFunc("/people", GetPeople).Methods("GET")
+	router.HandleFunc("/people", CreatePerson).Methods("POST")
 	router.HandleFunc("/people/{id}", GetPerson).Methods("GET")
 	router.HandleFunc("/people/{id}", CreatePerson).Methods("POST")
+	router.HandleFunc("/people/{id}", UpdatePerson).Methods("PUT", "PATCH")
 	router.HandleFunc("/people/{id}", DeletePerson).Methods("DELETE")
-	// log.Fatal(http.ListenAndServe("127.0.0.1:8000", router))
+	router.HandleFunc("/people/{id}/faces", GetFaces).Methods("GET")
+	router.HandleFunc("/people/{id}/faces", AddFace).Methods("POST")
+	router.HandleFunc("/people/{id}/faces/{faceId}", GetFace).Methods("GET")
+	router.HandleFunc("/people/{id}/faces/{faceId}", DeleteFace).Methods("DELETE")
+	router.HandleFunc("/analyze", analyzeImage).Methods("POST")
+	router.HandleFunc("/recognizer", GetRecognizer).Methods("GET")
+	router.HandleFunc("/recognizer/train", TrainRecognizer).Methods("POST")
+	router.HandleFunc("/sightings", GetSightings).Methods("GET")
+	router.HandleFunc("/bundle", GetBundle).Methods("GET")
+	router.HandleFunc("/bundle/manifest", GetBundleManifest).Methods("GET")
+	return router
+}
 
-	ln, err := net.Listen("tcp", ":8080")
-	if err != nil {
-		// handle error
+// main function to boot up everything
+func main() {
+	cfg := parseFlags()
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	var err error
+	if store, err = openStore(cfg.DataDir); err != nil {
+		log.Fatal(err)
+	}
+	defer store.Close()
+	if cfg.DataDir == "" {
+		faceStore = NewMemoryFaceStore()
+	} else if faceStore, err = OpenFileFaceStore(filepath.Join(cfg.DataDir, "faces")); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.DataDir != "" {
+		if err := recognizer.Load(filepath.Join(cfg.DataDir, RECOGNIZER_FILE)); err != nil {
+			log.Println("recognizer:", err)
+		}
+		if err := bundles.Load(filepath.Join(cfg.DataDir, BUNDLE_FILE)); err != nil {
+			log.Println("bundle:", err)
+		}
+	}
+	if _, _, ok := bundles.Current(); !ok && recognizer.Model() != nil {
+		if _, err := bundles.Publish(*recognizer.Model()); err != nil {
+			log.Println("bundle:", err)
+		}
 	}
-	conn, err := ln.Accept()
+	router := newRouter()
+
+	detector, err := NewFaceDetector(CASCADE_PATH, runtime.NumCPU())
 	if err != nil {
 		log.Println(err)
-		// handle error
+	} else {
+		faceDetector = detector
+		defer detector.Close()
 	}
-	for {
-		message, _ := bufio.NewReader(conn).ReadBytes('\n')
-		fmt.Print("Message Received:", string(message))
-		if conn == nil {
-			log.Println("nil conn")
-			break
-		}
+	ingest := NewIngestServer()
+	ingest.Handle(INGEST_TEXT, func(conn *IngestConn, msg IngestMessage) error {
+		var text string
+		json.Unmarshal(msg.Payload, &text)
+		log.Println("Message Received:", text)
+		return nil
+	})
+	ingest.Handle(INGEST_SIGHTING, recordSighting)
+
+	httpListener, err := cfg.listenHTTP()
+	if err != nil {
+		log.Fatal(err)
 	}
-	// buf := make([]byte, 10000)
-	// n, err := conn.Read(buf)
-	// log.Println(buf)
-	// log.Println(n)
-	// go handleConnection(conn)
+	ingestListener, err := cfg.listenIngest()
+	if err != nil {
+		log.Fatal(err)
+	}
+	server := &http.Server{Handler: router}
+	go func() {
+		log.Println("REST API on", httpListener.Addr(), "tls:", cfg.HTTPTLS)
+		if err := server.Serve(httpListener); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+	go func() {
+		log.Println("robot ingest on", ingestListener.Addr(), "tls:", cfg.IngestTLS, "mutual:", cfg.ClientCAFile != "")
+		if err := ingest.Serve(ingestListener); err != nil && err != errIngestClosed {
+			log.Fatal(err)
+		}
+	}()
 
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	log.Println("shutting down on", <-signals)
+	ctx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+	defer cancel()
+	if err := ingest.Shutdown(ctx); err != nil {
+		log.Println("ingest shutdown:", err)
+	}
+	if err := server.Shutdown(ctx); err != nil {
+		log.Println("http shutdown:", err)
+	}
 }
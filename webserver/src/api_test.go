@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestAPI serves the REST API over a memory store holding the example people.
+func newTestAPI(t *testing.T) http.Handler {
+	var err error
+	if store, err = openStore(""); err != nil {
+		t.Fatal(err)
+	}
+	faceStore = NewMemoryFaceStore()
+	return newRouter()
+}
+
+// request sends body to the API as JSON and returns the response.
+func request(api http.Handler, method string, path string, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, r)
+	return w
+}
+
+// decodeResponse checks the status and reads the body into v.
+func decodeResponse(t *testing.T, w *httptest.ResponseRecorder, status int, v interface{}) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("status %d, want %d: %s", w.Code, status, w.Body)
+	}
+	if v != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("%v: %s", err, w.Body)
+		}
+	}
+}
+
+func TestPeopleCRUD(t *testing.T) {
+	api := newTestAPI(t)
+
+	var people []Person
+	decodeResponse(t, request(api, "GET", "/people", ""), http.StatusOK, &people)
+	if len(people) != 2 {
+		t.Fatalf("%d example people, want 2", len(people))
+	}
+
+	var created Person
+	w := request(api, "POST", "/people", `{"id":"3","firstname":"Ada","address":{"city":"London"}}`)
+	decodeResponse(t, w, http.StatusCreated, &created)
+	if location := w.Header().Get("Location"); location != "/people/3" {
+		t.Errorf("Location %q, want /people/3", location)
+	}
+	decodeResponse(t, request(api, "POST", "/people/3", `{"firstname":"Ada"}`), http.StatusConflict, nil)
+
+	var got Person
+	decodeResponse(t, request(api, "GET", "/people/3", ""), http.StatusOK, &got)
+	if !reflect.DeepEqual(got, created) {
+		t.Errorf("GET %+v, want %+v", got, created)
+	}
+
+	var replaced Person
+	decodeResponse(t, request(api, "PUT", "/people/3", `{"firstname":"Ada","lastname":"Lovelace"}`), http.StatusOK, &replaced)
+	if want := (Person{ID: "3", Firstname: "Ada", Lastname: "Lovelace"}); !reflect.DeepEqual(replaced, want) {
+		t.Errorf("PUT gave %+v, want %+v", replaced, want)
+	}
+
+	decodeResponse(t, request(api, "DELETE", "/people/3", ""), http.StatusNoContent, nil)
+	decodeResponse(t, request(api, "GET", "/people/3", ""), http.StatusNotFound, nil)
+	decodeResponse(t, request(api, "DELETE", "/people/3", ""), http.StatusNotFound, nil)
+}
+
+func TestPatchPersonMergesAndClears(t *testing.T) {
+	api := newTestAPI(t)
+	for _, c := range []struct {
+		patch string
+		want  Person
+	}{
+		{`{"lastname":"Smith"}`, Person{ID: "1", Firstname: "John", Lastname: "Smith", Address: &Address{City: "City X", State: "State X"}}},
+		{`{"address":{"city":"City Y"}}`, Person{ID: "1", Firstname: "John", Lastname: "Smith", Address: &Address{City: "City Y", State: "State X"}}},
+		{`{"lastname":null,"address":{"state":null}}`, Person{ID: "1", Firstname: "John", Address: &Address{City: "City Y"}}},
+		{`{"address":null}`, Person{ID: "1", Firstname: "John"}},
+	} {
+		var patched, stored Person
+		decodeResponse(t, request(api, "PATCH", "/people/1", c.patch), http.StatusOK, &patched)
+		decodeResponse(t, request(api, "GET", "/people/1", ""), http.StatusOK, &stored)
+		if !reflect.DeepEqual(patched, c.want) || !reflect.DeepEqual(stored, c.want) {
+			t.Errorf("PATCH %s gave %+v, stored %+v, want %+v", c.patch, patched, stored, c.want)
+		}
+	}
+}
+
+func TestPeopleRejectsBadRequests(t *testing.T) {
+	api := newTestAPI(t)
+	for _, c := range []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"POST", "/people", `{"id":"bad id","firstname":"Ada"}`, http.StatusBadRequest},
+		{"POST", "/people", `{"id":"4"}`, http.StatusBadRequest},
+		{"POST", "/people", `{"id":"4","firstname":"Ada","age":36}`, http.StatusBadRequest},
+		{"POST", "/people/4", `{"id":"5","firstname":"Ada"}`, http.StatusBadRequest},
+		{"PATCH", "/people/1", `{"age":36}`, http.StatusBadRequest},
+		{"PATCH", "/people/1", `["firstname"]`, http.StatusBadRequest},
+		{"PATCH", "/people/1", `{"firstname":null,"lastname":null}`, http.StatusBadRequest},
+		{"PATCH", "/people/1", `{"id":"2"}`, http.StatusBadRequest},
+		{"PATCH", "/people/9", `{"lastname":"Smith"}`, http.StatusNotFound},
+		{"PUT", "/people/9", `{"firstname":"Ada"}`, http.StatusNotFound},
+		{"GET", "/people?limit=0", "", http.StatusBadRequest},
+		{"GET", "/nowhere", "", http.StatusNotFound},
+		{"PUT", "/people", `{"firstname":"Ada"}`, http.StatusMethodNotAllowed},
+	} {
+		w := request(api, c.method, c.path, c.body)
+		var apiError APIError
+		if err := json.Unmarshal(w.Body.Bytes(), &apiError); err != nil || w.Code != c.status || apiError.Status != c.status || apiError.Error == "" {
+			t.Errorf("%s %s %s: %d %s, want a %d APIError", c.method, c.path, c.body, w.Code, w.Body, c.status)
+		}
+	}
+}
+
+func TestGetPeopleFiltersAndPages(t *testing.T) {
+	api := newTestAPI(t)
+	var people []Person
+	decodeResponse(t, request(api, "GET", "/people?city=city%20z", ""), http.StatusOK, &people)
+	if len(people) != 1 || people[0].ID != "2" {
+		t.Errorf("city filter gave %+v, want person 2", people)
+	}
+	w := request(api, "GET", "/people?name=doe&limit=1&offset=1", "")
+	decodeResponse(t, w, http.StatusOK, &people)
+	if len(people) != 1 || people[0].ID != "2" || w.Header().Get("X-Total-Count") != "2" {
+		t.Errorf("second page gave %+v of %s, want person 2 of 2", people, w.Header().Get("X-Total-Count"))
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"shared/facerec"
+	"shared/fileutil"
+)
+
+// Robots get everything recognition needs as one bundle: the recognizer model,
+// the cascade the detector runs, and the people the model's labels stand for.
+// A new bundle is published after every training, with the next version. Robots
+// poll GET /bundle/manifest and download GET /bundle when the version changes,
+// checking it against the manifest's sha256.
+
+const BUNDLE_FILE = "bundle.json"
+
+var errNoBundle = errors.New("no model bundle published, train the recognizer first")
+
+var bundles = &BundleStore{}
+
+// BundleStore holds the published bundle as it is served, safe for concurrent use
+type BundleStore struct {
+	mu       sync.RWMutex
+	path     string
+	data     []byte
+	manifest facerec.BundleManifest
+}
+
+// Load reads the bundle last published at path and publishes there from now on. A missing file is not an error.
+func (b *BundleStore) Load(path string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.path = path
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var bundle facerec.ModelBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return err
+	}
+	b.data = data
+	b.manifest = facerec.NewManifest(bundle, data)
+	return nil
+}
+
+// Current is the published bundle and its manifest, ok is false until there is one
+func (b *BundleStore) Current() (data []byte, manifest facerec.BundleManifest, ok bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.data, b.manifest, b.data != nil
+}
+
+// Publish builds a bundle around model with the next version and serves it from now on
+func (b *BundleStore) Publish(model facerec.RecognizerModel) (facerec.BundleManifest, error) {
+	cascade, err := ioutil.ReadFile(CASCADE_PATH)
+	if err != nil {
+		return facerec.BundleManifest{}, err
+	}
+	people := make(map[string]facerec.BundlePerson)
+	for _, sample := range model.Samples {
+		if _, ok := people[sample.PersonID]; ok {
+			continue
+		}
+		person, err := store.Get(sample.PersonID)
+		if err == ErrPersonNotFound {
+			continue // deleted since training, the robot only gets the label
+		}
+		if err != nil {
+			return facerec.BundleManifest{}, err
+		}
+		people[sample.PersonID] = facerec.BundlePerson{ID: person.ID, Firstname: person.Firstname, Lastname: person.Lastname}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	bundle := facerec.ModelBundle{
+		Version:    b.manifest.Version + 1,
+		CreatedAt:  time.Now().UTC(),
+		Recognizer: model,
+		Cascade:    filepath.Base(CASCADE_PATH),
+		Cascades:   map[string]string{filepath.Base(CASCADE_PATH): string(cascade)},
+		People:     people,
+	}
+	data, err := json.Marshal(bundle)
+	if err != nil {
+		return facerec.BundleManifest{}, err
+	}
+	if b.path != "" {
+		if err := fileutil.WriteFileAtomic(b.path, data); err != nil {
+			return facerec.BundleManifest{}, err
+		}
+	}
+	b.data = data
+	b.manifest = facerec.NewManifest(bundle, data)
+	return b.manifest, nil
+}
+
+func GetBundleManifest(w http.ResponseWriter, r *http.Request) {
+	_, manifest, ok := bundles.Current()
+	if !ok {
+		writeError(w, http.StatusNotFound, errNoBundle.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, manifest)
+}
+
+// The bundle itself, its sha256 is also the ETag
+func GetBundle(w http.ResponseWriter, r *http.Request) {
+	data, manifest, ok := bundles.Current()
+	if !ok {
+		writeError(w, http.StatusNotFound, errNoBundle.Error())
+		return
+	}
+	etag := `"` + manifest.SHA256 + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("X-Bundle-Version", strconv.FormatInt(manifest.Version, 10))
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	if _, err := w.Write(data); err != nil {
+		log.Println("sending bundle:", err)
+	}
+}
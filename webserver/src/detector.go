@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+	"sync"
+
+	"github.com/lazywei/go-opencv/opencv"
+	"shared/haar"
+)
+
+const CASCADE_PATH = "assets/haarcascade_frontalface_alt.xml"
+
+var errDetectorClosed = errors.New("face detector closed")
+
+// DetectorParams match the skill's, so a frame analyzed here gives the same faces as on the robot
+type DetectorParams struct {
+	ScaleFactor  float64 `json:"scaleFactor"`
+	MinNeighbors int     `json:"minNeighbors"`
+	MinSize      int     `json:"minSize"`
+	MaxSize      int     `json:"maxSize"`
+}
+
+func DefaultDetectorParams() DetectorParams {
+	return DetectorParams{
+		ScaleFactor:  1.1,
+		MinNeighbors: 3,
+	}
+}
+
+func (p DetectorParams) Validate() error {
+	switch {
+	case p.ScaleFactor <= 1:
+		return errors.New("scaleFactor must be greater than 1")
+	case p.MinNeighbors < 0:
+		return errors.New("minNeighbors must not be negative")
+	case p.MinSize < 0 || p.MaxSize < 0:
+		return errors.New("sizes must not be negative")
+	case p.MaxSize != 0 && p.MaxSize < p.MinSize:
+		return errors.New("maxSize must be 0 or at least minSize")
+	}
+	return nil
+}
+
+// A face found in an image, in that image's pixels
+type Face struct {
+	X          int     `json:"x"`
+	Y          int     `json:"y"`
+	Width      int     `json:"width"`
+	Height     int     `json:"height"`
+	Neighbors  int     `json:"neighbors"`
+	Confidence float64 `json:"confidence"`
+	// set when the recognizer is trained, UNKNOWN_PERSON when the face matches nobody
+	PersonID            string  `json:"personId,omitempty"`
+	RecognitionDistance float64 `json:"recognitionDistance,omitempty"`
+}
+
+// FaceDetector keeps a pool of loaded cascades, each used by one request at a time
+type FaceDetector struct {
+	size      int
+	cascades  chan *haar.Cascade
+	closeOnce sync.Once
+}
+
+func NewFaceDetector(path string, poolSize int) (*FaceDetector, error) {
+	if poolSize < 1 {
+		poolSize = 1
+	}
+	fd := &FaceDetector{cascades: make(chan *haar.Cascade, poolSize)}
+	for i := 0; i < poolSize; i++ {
+		cascade, err := haar.Load(path)
+		if err != nil {
+			fd.Close()
+			return nil, err
+		}
+		fd.cascades <- cascade
+		fd.size++
+	}
+	return fd, nil
+}
+
+// Detect returns every face in img, waiting for a free cascade if all are busy
+func (fd *FaceDetector) Detect(img image.Image, params DetectorParams) ([]Face, error) {
+	if img == nil {
+		return nil, errors.New("no image")
+	}
+	cascade, ok := <-fd.cascades
+	if !ok {
+		return nil, errDetectorClosed
+	}
+	defer func() { fd.cascades <- cascade }()
+
+	cvimg := opencv.FromImage(toRGBA(img))
+	if cvimg == nil {
+		return nil, errors.New("could not convert image")
+	}
+	defer cvimg.Release()
+
+	hits := cascade.Detect(cvimg, haar.Params{ScaleFactor: params.ScaleFactor, MinNeighbors: params.MinNeighbors, MinSize: params.MinSize, MaxSize: params.MaxSize})
+	faces := make([]Face, 0, len(hits))
+	for _, hit := range hits {
+		face := Face{
+			X:         hit.Rect.Min.X,
+			Y:         hit.Rect.Min.Y,
+			Width:     hit.Rect.Dx(),
+			Height:    hit.Rect.Dy(),
+			Neighbors: hit.Neighbors,
+		}
+		if hit.Neighbors > 0 {
+			face.Confidence = float64(hit.Neighbors) / float64(hit.Neighbors+params.MinNeighbors)
+		}
+		faces = append(faces, face)
+	}
+	return faces, nil
+}
+
+// Close waits for running detections and releases every cascade
+func (fd *FaceDetector) Close() {
+	fd.closeOnce.Do(func() {
+		for i := 0; i < fd.size; i++ {
+			(<-fd.cascades).Release()
+		}
+		close(fd.cascades)
+	})
+}
+
+// toRGBA copies decoded JPEGs (YCbCr) and PNGs into the layout opencv.FromImage expects
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Bounds().Min == image.ZP {
+		return rgba
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	return rgba
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"shared/facerec"
+	"shared/fileutil"
+)
+
+// Enrolled faces. Each sample is the face cropped out of an upload, turned to
+// grayscale, resized to FACE_SAMPLE_SIZE and histogram equalized (NormalizeFace
+// in shared/facerec), which is what the recognizer trains on.
+
+const FACE_MIN_SIZE = 40
+
+var ErrFaceNotFound = errors.New("face sample not found")
+
+var faceStore FaceStore
+
+// Where the face came from in the uploaded image
+type FaceSource struct {
+	X           int     `json:"x"`
+	Y           int     `json:"y"`
+	Width       int     `json:"width"`
+	Height      int     `json:"height"`
+	ImageWidth  int     `json:"imageWidth"`
+	ImageHeight int     `json:"imageHeight"`
+	Confidence  float64 `json:"confidence"`
+}
+
+type FaceSample struct {
+	ID        string     `json:"id"`
+	PersonID  string     `json:"personId"`
+	CreatedAt time.Time  `json:"createdAt"`
+	Width     int        `json:"width"`
+	Height    int        `json:"height"`
+	Source    FaceSource `json:"source"`
+}
+
+// Where face samples live, safe for concurrent use
+type FaceStore interface {
+	Add(sample FaceSample, face *image.Gray) error
+	List(personID string) ([]FaceSample, error)
+	Get(personID string, faceID string) (FaceSample, *image.Gray, error)
+	Delete(personID string, faceID string) error
+	DeletePerson(personID string) error
+}
+
+func newFaceID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// largestFace is the face an enrollment upload is about
+func largestFace(faces []Face) (Face, bool) {
+	var best Face
+	for _, face := range faces {
+		if face.Width*face.Height > best.Width*best.Height {
+			best = face
+		}
+	}
+	return best, len(faces) > 0
+}
+
+// Enroll the largest face in an uploaded image (same formats as /analyze) for a person
+func AddFace(w http.ResponseWriter, r *http.Request) {
+	personID := mux.Vars(r)["id"]
+	if _, err := store.Get(personID); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if faceDetector == nil {
+		writeError(w, http.StatusServiceUnavailable, "face detector not loaded")
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, MAX_UPLOAD_BYTES)
+	data, _, status, err := readImage(r)
+	if err != nil {
+		writeError(w, status, err.Error())
+		return
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		writeError(w, http.StatusUnsupportedMediaType, "could not decode image: "+err.Error())
+		return
+	}
+	params := DefaultDetectorParams()
+	params.MinSize = FACE_MIN_SIZE
+	faces, err := faceDetector.Detect(img, params)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	face, ok := largestFace(faces)
+	if !ok {
+		writeError(w, http.StatusUnprocessableEntity, "no face found in the image")
+		return
+	}
+
+	b := img.Bounds()
+	rect := image.Rect(face.X, face.Y, face.X+face.Width, face.Y+face.Height).Add(b.Min)
+	sample := FaceSample{
+		ID:        newFaceID(),
+		PersonID:  personID,
+		CreatedAt: time.Now().UTC(),
+		Width:     facerec.FACE_SAMPLE_SIZE,
+		Height:    facerec.FACE_SAMPLE_SIZE,
+		Source: FaceSource{
+			X: face.X, Y: face.Y, Width: face.Width, Height: face.Height,
+			ImageWidth: b.Dx(), ImageHeight: b.Dy(), Confidence: face.Confidence,
+		},
+	}
+	if err := faceStore.Add(sample, facerec.NormalizeFace(img, rect)); err != nil {
+		writeFaceStoreError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/people/"+personID+"/faces/"+sample.ID)
+	writeJSON(w, http.StatusCreated, sample)
+}
+
+// List the samples of a person, oldest first
+func GetFaces(w http.ResponseWriter, r *http.Request) {
+	personID := mux.Vars(r)["id"]
+	if _, err := store.Get(personID); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	samples, err := faceStore.List(personID)
+	if err != nil {
+		writeFaceStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, samples)
+}
+
+// The normalized sample as a PNG, or its metadata with ?format=json
+func GetFace(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if _, err := store.Get(vars["id"]); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	sample, face, err := faceStore.Get(vars["id"], vars["faceId"])
+	if err != nil {
+		writeFaceStoreError(w, err)
+		return
+	}
+	if r.URL.Query().Get("format") == "json" {
+		writeJSON(w, http.StatusOK, sample)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	png.Encode(w, face)
+}
+
+func DeleteFace(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if _, err := store.Get(vars["id"]); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if err := faceStore.Delete(vars["id"], vars["faceId"]); err != nil {
+		writeFaceStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeFaceStoreError(w http.ResponseWriter, err error) {
+	if err == ErrFaceNotFound {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeStoreError(w, err)
+}
+
+// MemoryFaceStore keeps samples in memory
+type MemoryFaceStore struct {
+	mu      sync.RWMutex
+	samples map[string][]FaceSample
+	faces   map[string]*image.Gray
+}
+
+func NewMemoryFaceStore() *MemoryFaceStore {
+	return &MemoryFaceStore{samples: make(map[string][]FaceSample), faces: make(map[string]*image.Gray)}
+}
+
+func (s *MemoryFaceStore) Add(sample FaceSample, face *image.Gray) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.samples[sample.PersonID] = append(s.samples[sample.PersonID], sample)
+	s.faces[sample.ID] = face
+	return nil
+}
+
+func (s *MemoryFaceStore) List(personID string) ([]FaceSample, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]FaceSample{}, s.samples[personID]...), nil
+}
+
+func (s *MemoryFaceStore) Get(personID string, faceID string) (FaceSample, *image.Gray, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, sample := range s.samples[personID] {
+		if sample.ID == faceID {
+			return sample, s.faces[faceID], nil
+		}
+	}
+	return FaceSample{}, nil, ErrFaceNotFound
+}
+
+func (s *MemoryFaceStore) Delete(personID string, faceID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	samples := s.samples[personID]
+	for i, sample := range samples {
+		if sample.ID == faceID {
+			s.samples[personID] = append(samples[:i], samples[i+1:]...)
+			delete(s.faces, faceID)
+			return nil
+		}
+	}
+	return ErrFaceNotFound
+}
+
+func (s *MemoryFaceStore) DeletePerson(personID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sample := range s.samples[personID] {
+		delete(s.faces, sample.ID)
+	}
+	delete(s.samples, personID)
+	return nil
+}
+
+// FileFaceStore keeps each sample as <dir>/<personID>/<faceID>.png with its metadata next to it in <faceID>.json
+type FileFaceStore struct {
+	mu  sync.RWMutex
+	dir string
+}
+
+func OpenFileFaceStore(dir string) (*FileFaceStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileFaceStore{dir: dir}, nil
+}
+
+// path keeps IDs from walking out of the store, person IDs are validated and face IDs are hex
+func (s *FileFaceStore) path(personID string, name string) string {
+	return filepath.Join(s.dir, filepath.Base(personID), filepath.Base(name))
+}
+
+func (s *FileFaceStore) Add(sample FaceSample, face *image.Gray) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(filepath.Join(s.dir, filepath.Base(sample.PersonID)), 0755); err != nil {
+		return err
+	}
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, face); err != nil {
+		return err
+	}
+	if err := fileutil.WriteFileAtomic(s.path(sample.PersonID, sample.ID+".png"), buf.Bytes()); err != nil {
+		return err
+	}
+	meta, err := json.Marshal(sample)
+	if err != nil {
+		return err
+	}
+	// the metadata goes last, a sample without it is not listed
+	return fileutil.WriteFileAtomic(s.path(sample.PersonID, sample.ID+".json"), meta)
+}
+
+func (s *FileFaceStore) List(personID string) ([]FaceSample, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	matches, err := filepath.Glob(s.path(personID, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	samples := make([]FaceSample, 0, len(matches))
+	for _, path := range matches {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var sample FaceSample
+		if err := json.Unmarshal(data, &sample); err != nil {
+			return nil, err
+		}
+		samples = append(samples, sample)
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].CreatedAt.Before(samples[j].CreatedAt) })
+	return samples, nil
+}
+
+func (s *FileFaceStore) Get(personID string, faceID string) (FaceSample, *image.Gray, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var sample FaceSample
+	data, err := ioutil.ReadFile(s.path(personID, faceID+".json"))
+	if os.IsNotExist(err) {
+		return sample, nil, ErrFaceNotFound
+	}
+	if err != nil {
+		return sample, nil, err
+	}
+	if err := json.Unmarshal(data, &sample); err != nil {
+		return sample, nil, err
+	}
+	f, err := os.Open(s.path(personID, faceID+".png"))
+	if err != nil {
+		return sample, nil, err
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		return sample, nil, err
+	}
+	gray, ok := img.(*image.Gray)
+	if !ok {
+		return sample, nil, errors.New("face sample " + faceID + " is not grayscale")
+	}
+	return sample, gray, nil
+}
+
+// Delete removes the png before the json, so a failure leaves the sample listed rather than an orphaned png
+func (s *FileFaceStore) Delete(personID string, faceID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	metadata := s.path(personID, faceID+".json")
+	if _, err := os.Stat(metadata); err != nil {
+		if os.IsNotExist(err) {
+			return ErrFaceNotFound
+		}
+		return err
+	}
+	if err := os.Remove(s.path(personID, faceID+".png")); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Remove(metadata)
+}
+
+func (s *FileFaceStore) DeletePerson(personID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return os.RemoveAll(filepath.Join(s.dir, filepath.Base(personID)))
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"image"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"shared/facerec"
+)
+
+func addTestFace(t *testing.T, faces FaceStore, personID string, faceID string) {
+	sample := FaceSample{ID: faceID, PersonID: personID, CreatedAt: time.Now(), Width: facerec.FACE_SAMPLE_SIZE, Height: facerec.FACE_SAMPLE_SIZE}
+	if err := faces.Add(sample, image.NewGray(image.Rect(0, 0, facerec.FACE_SAMPLE_SIZE, facerec.FACE_SAMPLE_SIZE))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileFaceStoreDelete(t *testing.T) {
+	dir, err := ioutil.TempDir("", "faces")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	faces, err := OpenFileFaceStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addTestFace(t, faces, "1", "a1")
+	if err := faces.Delete("1", "a1"); err != nil {
+		t.Fatal(err)
+	}
+	if left, _ := filepath.Glob(filepath.Join(dir, "1", "*")); len(left) != 0 {
+		t.Errorf("files left after delete: %v", left)
+	}
+	if err := faces.Delete("1", "a1"); err != ErrFaceNotFound {
+		t.Errorf("deleting twice: err = %v, want ErrFaceNotFound", err)
+	}
+}
+
+func TestFaceRoutesCheckPerson(t *testing.T) {
+	api := newTestAPI(t)
+	addTestFace(t, faceStore, "1", "a1")
+	// samples of a deleted person that were left behind are not reachable
+	addTestFace(t, faceStore, "9", "b1")
+	for _, c := range []struct {
+		method string
+		path   string
+		status int
+	}{
+		{"GET", "/people/1/faces/a1?format=json", http.StatusOK},
+		{"GET", "/people/1/faces/b1", http.StatusNotFound},
+		{"GET", "/people/9/faces", http.StatusNotFound},
+		{"GET", "/people/9/faces/b1", http.StatusNotFound},
+		{"DELETE", "/people/9/faces/b1", http.StatusNotFound},
+		{"DELETE", "/people/1/faces/a1", http.StatusNoContent},
+		{"GET", "/people/1/faces/a1", http.StatusNotFound},
+	} {
+		if w := request(api, c.method, c.path, ""); w.Code != c.status {
+			t.Errorf("%s %s: %d %s, want %d", c.method, c.path, w.Code, w.Body, c.status)
+		}
+	}
+	if _, _, err := faceStore.Get("9", "b1"); err != nil {
+		t.Errorf("DELETE through an unknown person removed its sample: %v", err)
+	}
+}
+
+// failingFaceStore is a MemoryFaceStore that can't delete people
+type failingFaceStore struct {
+	*MemoryFaceStore
+}
+
+func (failingFaceStore) DeletePerson(personID string) error {
+	return os.ErrPermission
+}
+
+func TestDeletePersonKeepsPersonWhenFacesRemain(t *testing.T) {
+	api := newTestAPI(t)
+	faceStore = failingFaceStore{NewMemoryFaceStore()}
+	if w := request(api, "DELETE", "/people/1", ""); w.Code != http.StatusInternalServerError {
+		t.Errorf("DELETE with failing face cleanup: %d %s, want 500", w.Code, w.Body)
+	}
+	if _, err := store.Get("1"); err != nil {
+		t.Errorf("person deleted although its faces were not: %v", err)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// Robots connect over TCP and send one message per line. A message is the
+// skill's envelope, {"v": 1, "type": "...", "time": ..., "payload": {...}};
+// a line that isn't JSON is handed to the "text" handler as is. Envelopes
+// newer than INGEST_PROTOCOL_VERSION are logged and dropped.
+
+const MAX_INGEST_LINE_BYTES = 16 << 20
+const INGEST_TEXT = "text"
+const INGEST_PROTOCOL_VERSION = 1
+
+var errIngestClosed = errors.New("ingest server closed")
+
+type IngestMessage struct {
+	Version int             `json:"v"`
+	Type    string          `json:"type"`
+	Time    int64           `json:"time"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// A robot connection, handlers can write back to it with Send
+type IngestConn struct {
+	net.Conn
+	writeMu sync.Mutex
+}
+
+// Send writes v as one JSON line
+func (c *IngestConn) Send(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err = c.Write(append(data, '\n'))
+	return err
+}
+
+type IngestHandler func(conn *IngestConn, msg IngestMessage) error
+
+type IngestServer struct {
+	mu        sync.Mutex
+	handlers  map[string]IngestHandler
+	listeners map[net.Listener]struct{}
+	conns     map[*IngestConn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+func NewIngestServer() *IngestServer {
+	return &IngestServer{
+		handlers:  make(map[string]IngestHandler),
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[*IngestConn]struct{}),
+	}
+}
+
+// Handle sets the handler for one message type, messages with no handler are logged and dropped
+func (s *IngestServer) Handle(msgType string, handler IngestHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[msgType] = handler
+}
+
+// Serve accepts robots on ln until Shutdown, each connection gets its own goroutine
+func (s *IngestServer) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		ln.Close()
+		return errIngestClosed
+	}
+	s.listeners[ln] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, ln)
+		s.mu.Unlock()
+	}()
+
+	var backoff time.Duration
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return errIngestClosed
+			}
+			// temporary errors, e.g. running out of file descriptors, may pass
+			if ne, ok := err.(net.Error); !ok || !ne.Temporary() {
+				return err
+			}
+			if backoff == 0 {
+				backoff = 5 * time.Millisecond
+			} else if backoff *= 2; backoff > time.Second {
+				backoff = time.Second
+			}
+			log.Println("ingest accept:", err, "retrying in", backoff)
+			time.Sleep(backoff)
+			continue
+		}
+		backoff = 0
+		c := &IngestConn{Conn: conn}
+		if !s.track(c) {
+			conn.Close()
+			return errIngestClosed
+		}
+		go s.serveConn(c)
+	}
+}
+
+func (s *IngestServer) track(c *IngestConn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.conns[c] = struct{}{}
+	s.wg.Add(1)
+	return true
+}
+
+func (s *IngestServer) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+func (s *IngestServer) serveConn(c *IngestConn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		c.Close()
+	}()
+	remote := c.RemoteAddr().String()
+	log.Println("robot connected:", remote)
+
+	scanner := bufio.NewScanner(c)
+	scanner.Buffer(make([]byte, 64*1024), MAX_INGEST_LINE_BYTES)
+	// after Shutdown the line being dispatched is the last one
+	for !s.isClosed() && scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		s.dispatch(c, line)
+	}
+	if err := scanner.Err(); err != nil && !s.isClosed() {
+		log.Println("robot", remote, "read:", err)
+	}
+	log.Println("robot disconnected:", remote)
+}
+
+func (s *IngestServer) dispatch(c *IngestConn, line []byte) {
+	var msg IngestMessage
+	if err := json.Unmarshal(line, &msg); err != nil || msg.Type == "" {
+		text, _ := json.Marshal(string(line))
+		msg = IngestMessage{Version: INGEST_PROTOCOL_VERSION, Type: INGEST_TEXT, Time: time.Now().UnixNano() / int64(time.Millisecond), Payload: text}
+	}
+	if msg.Version < 1 || msg.Version > INGEST_PROTOCOL_VERSION {
+		log.Println("unsupported message version", msg.Version, "for", msg.Type, "from", c.RemoteAddr())
+		return
+	}
+	s.mu.Lock()
+	handler, ok := s.handlers[msg.Type]
+	s.mu.Unlock()
+	if !ok {
+		log.Println("no ingest handler for", msg.Type, "from", c.RemoteAddr())
+		return
+	}
+	if err := handler(c, msg); err != nil {
+		log.Println("ingest", msg.Type, "from", c.RemoteAddr(), ":", err)
+	}
+}
+
+// Shutdown stops accepting and reading new lines, lets every connection finish
+// the message it is dispatching, then closes it. Connections still busy when
+// ctx ends are closed under their handlers.
+func (s *IngestServer) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	for ln := range s.listeners {
+		ln.Close()
+	}
+	// wakes connections blocked reading, serveConn sees closed and returns
+	for c := range s.conns {
+		c.SetReadDeadline(time.Now())
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		for c := range s.conns {
+			c.Close()
+		}
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startIngest serves s on a loopback port, Serve's result goes to the returned channel.
+func startIngest(t *testing.T, s *IngestServer) (string, <-chan error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(ln) }()
+	return ln.Addr().String(), served
+}
+
+func dialIngest(t *testing.T, addr string) net.Conn {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// collect records every message of the given types that reaches s.
+func collect(s *IngestServer, types ...string) <-chan IngestMessage {
+	received := make(chan IngestMessage, 100)
+	for _, msgType := range types {
+		s.Handle(msgType, func(conn *IngestConn, msg IngestMessage) error {
+			received <- msg
+			return nil
+		})
+	}
+	return received
+}
+
+func receive(t *testing.T, received <-chan IngestMessage) IngestMessage {
+	t.Helper()
+	select {
+	case msg := <-received:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+	return IngestMessage{}
+}
+
+// waitClosed reads conn until the server closes it.
+func waitClosed(t *testing.T, conn net.Conn) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.Copy(ioutil.Discard, conn); err != nil {
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			t.Fatal("server did not close the connection")
+		}
+	}
+}
+
+func textOf(t *testing.T, msg IngestMessage) string {
+	var text string
+	if err := json.Unmarshal(msg.Payload, &text); err != nil {
+		t.Error(err)
+	}
+	return text
+}
+
+func TestIngestDispatchesByType(t *testing.T) {
+	s := NewIngestServer()
+	received := collect(s, "state", INGEST_TEXT)
+	addr, _ := startIngest(t, s)
+	defer s.Shutdown(context.Background())
+	conn := dialIngest(t, addr)
+	defer conn.Close()
+
+	fmt.Fprint(conn, `{"v":1,"type":"state","time":1,"payload":"searching"}`+"\n")
+	fmt.Fprint(conn, "hello robot\n\n")
+	fmt.Fprint(conn, `{"v":2,"type":"state","time":2,"payload":"from the future"}`+"\n")
+	fmt.Fprint(conn, `{"type":"state","time":3,"payload":"no version"}`+"\n")
+	fmt.Fprint(conn, `{"v":1,"type":"telemetry","time":4,"payload":{}}`+"\n")
+	fmt.Fprint(conn, "end\n")
+
+	if msg := receive(t, received); msg.Type != "state" || msg.Time != 1 || string(msg.Payload) != `"searching"` {
+		t.Errorf("first message %+v, want the state", msg)
+	}
+	if msg := receive(t, received); msg.Type != INGEST_TEXT || textOf(t, msg) != "hello robot" {
+		t.Errorf("second message %+v, want the text line", msg)
+	}
+	// unsupported versions and types without a handler are dropped
+	if msg := receive(t, received); msg.Type != INGEST_TEXT || textOf(t, msg) != "end" {
+		t.Errorf("third message %+v, want the end text line", msg)
+	}
+}
+
+func TestIngestServesConcurrentClients(t *testing.T) {
+	const clients, lines = 8, 50
+	s := NewIngestServer()
+	var mu sync.Mutex
+	counts := make(map[string]int)
+	s.Handle(INGEST_TEXT, func(conn *IngestConn, msg IngestMessage) error {
+		mu.Lock()
+		defer mu.Unlock()
+		counts[strings.Fields(textOf(t, msg))[0]]++
+		return nil
+	})
+	addr, _ := startIngest(t, s)
+
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			w := bufio.NewWriter(conn)
+			for j := 0; j < lines; j++ {
+				fmt.Fprintf(w, "client%d line %d\n", i, j)
+			}
+			w.Flush()
+			conn.(*net.TCPConn).CloseWrite()
+			waitClosed(t, conn)
+			conn.Close()
+		}(i)
+	}
+	wg.Wait()
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for i := 0; i < clients; i++ {
+		if got := counts[fmt.Sprintf("client%d", i)]; got != lines {
+			t.Errorf("client%d: %d lines dispatched, want %d", i, got, lines)
+		}
+	}
+}
+
+func TestIngestDropsConnectionOnLongLine(t *testing.T) {
+	s := NewIngestServer()
+	received := collect(s, INGEST_TEXT)
+	addr, _ := startIngest(t, s)
+	defer s.Shutdown(context.Background())
+	conn := dialIngest(t, addr)
+	defer conn.Close()
+
+	fmt.Fprint(conn, "before\n")
+	go func() {
+		// the server hangs up part way, the write error is expected
+		conn.Write([]byte(strings.Repeat("x", MAX_INGEST_LINE_BYTES+1) + "\n"))
+	}()
+	if msg := receive(t, received); textOf(t, msg) != "before" {
+		t.Errorf("got %+v, want the line before the long one", msg)
+	}
+	waitClosed(t, conn)
+	select {
+	case msg := <-received:
+		t.Errorf("the long line was dispatched: %d bytes", len(msg.Payload))
+	default:
+	}
+}
+
+func TestIngestForgetsConnectionOnEOF(t *testing.T) {
+	s := NewIngestServer()
+	received := collect(s, INGEST_TEXT)
+	addr, _ := startIngest(t, s)
+	defer s.Shutdown(context.Background())
+	conn := dialIngest(t, addr)
+	fmt.Fprint(conn, "bye\n")
+	receive(t, received)
+	conn.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.mu.Lock()
+		open := len(s.conns)
+		s.mu.Unlock()
+		if open == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d connections still tracked after the robot hung up", open)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestIngestShutdownFinishesDispatch(t *testing.T) {
+	s := NewIngestServer()
+	entered, release := make(chan struct{}), make(chan struct{})
+	finished := make(chan struct{}, 1)
+	s.Handle("slow", func(conn *IngestConn, msg IngestMessage) error {
+		close(entered)
+		<-release
+		finished <- struct{}{}
+		return conn.Send("done")
+	})
+	received := collect(s, INGEST_TEXT)
+	addr, served := startIngest(t, s)
+	busy := dialIngest(t, addr)
+	defer busy.Close()
+	idle := dialIngest(t, addr)
+	defer idle.Close()
+	fmt.Fprint(idle, "idle\n")
+	receive(t, received)
+	fmt.Fprint(busy, `{"v":1,"type":"slow","time":1,"payload":null}`+"\n"+"after shutdown\n")
+	<-entered
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- s.Shutdown(context.Background()) }()
+	waitClosed(t, idle)
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown returned %v with a message still being dispatched", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	if err := <-shutdown; err != nil {
+		t.Fatal(err)
+	}
+	<-finished
+	// the handler's reply went out before the connection closed
+	reply, err := bufio.NewReader(busy).ReadString('\n')
+	if err != nil || reply != "\"done\"\n" {
+		t.Errorf("reply %q, %v, want the handler's reply", reply, err)
+	}
+	select {
+	case msg := <-received:
+		t.Errorf("%+v was read after Shutdown", msg)
+	default:
+	}
+	if err := <-served; err != errIngestClosed {
+		t.Errorf("Serve returned %v, want errIngestClosed", err)
+	}
+}
+
+func TestIngestShutdownClosesStuckConnections(t *testing.T) {
+	s := NewIngestServer()
+	entered, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	s.Handle("stuck", func(conn *IngestConn, msg IngestMessage) error {
+		close(entered)
+		<-release
+		return nil
+	})
+	addr, _ := startIngest(t, s)
+	conn := dialIngest(t, addr)
+	defer conn.Close()
+	fmt.Fprint(conn, `{"v":1,"type":"stuck","time":1,"payload":null}`+"\n")
+	<-entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Shutdown returned %v, want the deadline", err)
+	}
+	waitClosed(t, conn)
+}
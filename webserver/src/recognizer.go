@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"image"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"shared/facerec"
+	"shared/fileutil"
+)
+
+// The recognizer is trained here from the enrolled faces and saved next to the
+// people, the robot gets a copy of the model in the bundle and predicts on its own.
+
+const RECOGNIZER_FILE = "recognizer.json"
+
+var errNoFaces = errors.New("no enrolled faces to train on")
+
+var recognizer = &Recognizer{}
+
+// Recognizer holds the current model, safe for concurrent use
+type Recognizer struct {
+	mu    sync.RWMutex
+	model *facerec.RecognizerModel
+	path  string
+}
+
+// RecognizerSummary is the model without its histograms
+type RecognizerSummary struct {
+	Version   int       `json:"version"`
+	TrainedAt time.Time `json:"trainedAt"`
+	Threshold float64   `json:"threshold"`
+	People    int       `json:"people"`
+	Samples   int       `json:"samples"`
+}
+
+// Load reads the model saved at path and saves there after every training. A missing file leaves the recognizer untrained.
+func (rec *Recognizer) Load(path string) error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.path = path
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var model facerec.RecognizerModel
+	if err := json.Unmarshal(data, &model); err != nil {
+		return err
+	}
+	if err := model.Validate(); err != nil {
+		return err
+	}
+	rec.model = &model
+	return nil
+}
+
+// Model is the current model, nil until one is trained or loaded
+func (rec *Recognizer) Model() *facerec.RecognizerModel {
+	rec.mu.RLock()
+	defer rec.mu.RUnlock()
+	return rec.model
+}
+
+// Train builds a new model from every enrolled face and makes it current
+func (rec *Recognizer) Train(threshold float64) (*facerec.RecognizerModel, error) {
+	people, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	var faces []facerec.LabeledFace
+	for _, person := range people {
+		samples, err := faceStore.List(person.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, sample := range samples {
+			_, face, err := faceStore.Get(person.ID, sample.ID)
+			if err != nil {
+				return nil, err
+			}
+			faces = append(faces, facerec.LabeledFace{PersonID: person.ID, Face: face})
+		}
+	}
+	if len(faces) == 0 {
+		return nil, errNoFaces
+	}
+	model, err := facerec.TrainModel(faces, threshold)
+	if err != nil {
+		return nil, err
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.path != "" {
+		data, err := json.Marshal(model)
+		if err != nil {
+			return nil, err
+		}
+		if err := fileutil.WriteFileAtomic(rec.path, data); err != nil {
+			return nil, err
+		}
+	}
+	rec.model = &model
+	return &model, nil
+}
+
+// Recognize fills in PersonID and RecognitionDistance of faces found in img, when there is a model
+func (rec *Recognizer) Recognize(img image.Image, faces []Face) {
+	model := rec.Model()
+	if model == nil {
+		return
+	}
+	b := img.Bounds()
+	for i, face := range faces {
+		rect := image.Rect(face.X, face.Y, face.X+face.Width, face.Y+face.Height).Add(b.Min)
+		result := model.Predict(facerec.NormalizeFace(img, rect))
+		faces[i].PersonID = result.PersonID
+		faces[i].RecognitionDistance = result.Distance
+	}
+}
+
+func summarize(model *facerec.RecognizerModel) RecognizerSummary {
+	return RecognizerSummary{
+		Version:   model.Version,
+		TrainedAt: model.TrainedAt,
+		Threshold: model.Threshold,
+		People:    model.People(),
+		Samples:   len(model.Samples),
+	}
+}
+
+func GetRecognizer(w http.ResponseWriter, r *http.Request) {
+	model := recognizer.Model()
+	if model == nil {
+		writeError(w, http.StatusNotFound, "recognizer not trained")
+		return
+	}
+	writeJSON(w, http.StatusOK, summarize(model))
+}
+
+// What POST /recognizer/train answers with, the summary and the bundle published for robots
+type TrainResult struct {
+	RecognizerSummary
+	Bundle facerec.BundleManifest `json:"bundle"`
+}
+
+// Train the recognizer on every enrolled face and publish it to robots, ?threshold= sets the distance above which faces are unknown
+func TrainRecognizer(w http.ResponseWriter, r *http.Request) {
+	threshold := facerec.DEFAULT_RECOGNITION_THRESHOLD
+	if v := r.URL.Query().Get("threshold"); v != "" {
+		t, err := strconv.ParseFloat(v, 64)
+		if err != nil || t <= 0 {
+			writeError(w, http.StatusBadRequest, "threshold must be a positive number")
+			return
+		}
+		threshold = t
+	}
+	model, err := recognizer.Train(threshold)
+	if err == errNoFaces {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if err != nil {
+		log.Println("training recognizer:", err)
+		writeError(w, http.StatusInternalServerError, "could not train the recognizer")
+		return
+	}
+	manifest, err := bundles.Publish(*model)
+	if err != nil {
+		log.Println("publishing bundle:", err)
+		writeError(w, http.StatusInternalServerError, "trained, but could not publish the bundle")
+		return
+	}
+	writeJSON(w, http.StatusOK, TrainResult{RecognizerSummary: summarize(model), Bundle: manifest})
+}
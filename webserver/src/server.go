@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+)
+
+// Where the REST API and the robot ingest listener run, and how they are secured.
+// The server runs from webserver/, relative paths such as CASCADE_PATH and -data-dir
+// are from there. TLS needs -cert and -key; the cert.pem and key.pem in src are
+// expired and passphrase protected, for development make a pair with:
+//
+//	openssl req -x509 -newkey rsa:2048 -nodes -days 365 -subj /CN=localhost -keyout dev-key.pem -out dev-cert.pem
+type ServerConfig struct {
+	HTTPAddr   string
+	HTTPTLS    bool
+	IngestAddr string
+	IngestTLS  bool
+	CertFile   string
+	KeyFile    string
+	// PEM bundle of CAs robot certificates must chain to, setting it turns on mutual TLS for ingest
+	ClientCAFile string
+	// Where people, their faces, the recognizer and the robot bundle are kept, empty keeps them in memory only
+	DataDir string
+}
+
+func parseFlags() ServerConfig {
+	var cfg ServerConfig
+	flag.StringVar(&cfg.HTTPAddr, "http-addr", ":8000", "address of the REST API")
+	flag.BoolVar(&cfg.HTTPTLS, "http-tls", false, "serve the REST API over HTTPS")
+	flag.StringVar(&cfg.IngestAddr, "ingest-addr", ":8080", "address robots connect to")
+	flag.BoolVar(&cfg.IngestTLS, "ingest-tls", false, "require TLS from robots")
+	flag.StringVar(&cfg.CertFile, "cert", "", "server certificate (PEM), required with -http-tls or -ingest-tls")
+	flag.StringVar(&cfg.KeyFile, "key", "", "server private key (PEM, unencrypted), required with -http-tls or -ingest-tls")
+	flag.StringVar(&cfg.ClientCAFile, "client-ca", "", "CA bundle for robot client certificates, enables mutual TLS on the ingest listener")
+	flag.StringVar(&cfg.DataDir, "data-dir", "data", "directory for people, faces, the recognizer and the robot bundle, empty for memory only")
+	flag.Parse()
+	return cfg
+}
+
+func (cfg ServerConfig) Validate() error {
+	if cfg.ClientCAFile != "" && !cfg.IngestTLS {
+		return errors.New("-client-ca needs -ingest-tls")
+	}
+	if (cfg.HTTPTLS || cfg.IngestTLS) && (cfg.CertFile == "" || cfg.KeyFile == "") {
+		return errors.New("-http-tls and -ingest-tls need -cert and -key")
+	}
+	if _, err := os.Stat(CASCADE_PATH); err != nil {
+		return fmt.Errorf("%v, run the server from the webserver directory", err)
+	}
+	return nil
+}
+
+// listenHTTP returns the REST API listener, wrapped in TLS when asked
+func (cfg ServerConfig) listenHTTP() (net.Listener, error) {
+	ln, err := net.Listen("tcp", cfg.HTTPAddr)
+	if err != nil || !cfg.HTTPTLS {
+		return ln, err
+	}
+	tlsConfig, err := cfg.tlsConfig("")
+	if err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return tls.NewListener(ln, tlsConfig), nil
+}
+
+// listenIngest returns the robot listener, wrapped in TLS (mutual when a client CA is set) when asked
+func (cfg ServerConfig) listenIngest() (net.Listener, error) {
+	ln, err := net.Listen("tcp", cfg.IngestAddr)
+	if err != nil || !cfg.IngestTLS {
+		return ln, err
+	}
+	tlsConfig, err := cfg.tlsConfig(cfg.ClientCAFile)
+	if err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return tls.NewListener(ln, tlsConfig), nil
+}
+
+func (cfg ServerConfig) tlsConfig(clientCAFile string) (*tls.Config, error) {
+	cert, err := loadKeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if clientCAFile != "" {
+		pem, err := ioutil.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", clientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
+
+// loadKeyPair is tls.LoadX509KeyPair with a useful error for passphrase protected keys,
+// which Go can't read (the bundled key.pem and server.key are such keys)
+func loadKeyPair(certFile string, keyFile string) (tls.Certificate, error) {
+	key, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if bytes.Contains(key, []byte("ENCRYPTED")) {
+		return tls.Certificate{}, fmt.Errorf("%s is passphrase protected, decrypt it with: openssl pkey -in %s -out key.unencrypted.pem, and pass -key key.unencrypted.pem", keyFile, keyFile)
+	}
+	cert, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.X509KeyPair(cert, key)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Robots send a "sighting" message whenever they recognize someone. The most
+// recent ones are kept in memory for GET /sightings.
+
+const INGEST_SIGHTING = "sighting"
+const MAX_SIGHTINGS = 1000
+
+var sightings = NewSightingLog(MAX_SIGHTINGS)
+
+// Sighting is the skill's sighting payload plus where and when it arrived.
+// Bearing is the head direction in degrees, Distance the estimated range in mm.
+type Sighting struct {
+	PersonID            string    `json:"personId"`
+	RecognitionDistance float64   `json:"recognitionDistance"`
+	FrameID             int64     `json:"frameId"`
+	Bearing             float64   `json:"bearing"`
+	Distance            float64   `json:"distance"`
+	Confidence          float64   `json:"confidence"`
+	CapturedAt          int64     `json:"capturedAt"`
+	ReceivedAt          time.Time `json:"receivedAt"`
+	Robot               string    `json:"robot"`
+}
+
+// SightingLog is a ring of the last sightings, safe for concurrent use
+type SightingLog struct {
+	mu        sync.Mutex
+	sightings []Sighting
+	next      int
+	full      bool
+}
+
+func NewSightingLog(size int) *SightingLog {
+	return &SightingLog{sightings: make([]Sighting, size)}
+}
+
+func (l *SightingLog) Add(sighting Sighting) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sightings[l.next] = sighting
+	if l.next++; l.next == len(l.sightings) {
+		l.next = 0
+		l.full = true
+	}
+}
+
+// Recent returns up to limit sightings, newest first, of personID or of everyone when it is empty
+func (l *SightingLog) Recent(personID string, limit int) []Sighting {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := l.next
+	if l.full {
+		n = len(l.sightings)
+	}
+	recent := make([]Sighting, 0)
+	for i := 1; i <= n && len(recent) < limit; i++ {
+		sighting := l.sightings[(l.next-i+len(l.sightings))%len(l.sightings)]
+		if personID == "" || sighting.PersonID == personID {
+			recent = append(recent, sighting)
+		}
+	}
+	return recent
+}
+
+// recordSighting is the ingest handler for sighting messages
+func recordSighting(conn *IngestConn, msg IngestMessage) error {
+	var sighting Sighting
+	if err := json.Unmarshal(msg.Payload, &sighting); err != nil {
+		return err
+	}
+	if sighting.PersonID == "" {
+		return errors.New("sighting without a personId")
+	}
+	sighting.ReceivedAt = time.Now().UTC()
+	sighting.Robot = conn.RemoteAddr().String()
+	sightings.Add(sighting)
+	return nil
+}
+
+// List recent sightings, newest first, filtered by ?personId= and capped by ?limit=
+func GetSightings(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := DEFAULT_PAGE_LIMIT
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MAX_SIGHTINGS {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be 1-%d", MAX_SIGHTINGS))
+			return
+		}
+		limit = n
+	}
+	writeJSON(w, http.StatusOK, sightings.Recent(query.Get("personId"), limit))
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"shared/fileutil"
+)
+
+var ErrPersonNotFound = errors.New("person not found")
+var ErrPersonExists = errors.New("person already exists")
+
+// Where Person records live. Implementations are safe for concurrent use and
+// hand out copies, so callers can change what they get back.
+type PersonStore interface {
+	List() ([]Person, error)
+	Get(id string) (Person, error)
+	// Create fails with ErrPersonExists when the ID is taken
+	Create(person Person) error
+	// Update fails with ErrPersonNotFound when the ID is unknown
+	Update(person Person) error
+	// Modify stores change's result for the record under id, reading and writing it
+	// under one lock so concurrent changes all land. An error from change leaves the
+	// record as it was and is returned as is.
+	Modify(id string, change func(Person) (Person, error)) (Person, error)
+	// Delete fails with ErrPersonNotFound when the ID is unknown
+	Delete(id string) error
+	Close() error
+}
+
+func clonePerson(person Person) Person {
+	if person.Address != nil {
+		address := *person.Address
+		person.Address = &address
+	}
+	return person
+}
+
+// MemoryStore keeps people in memory, in the order they were created
+type MemoryStore struct {
+	mu     sync.RWMutex
+	people map[string]Person
+	order  []string
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{people: make(map[string]Person)}
+}
+
+func (s *MemoryStore) List() ([]Person, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.list(), nil
+}
+
+func (s *MemoryStore) list() []Person {
+	list := make([]Person, 0, len(s.order))
+	for _, id := range s.order {
+		list = append(list, clonePerson(s.people[id]))
+	}
+	return list
+}
+
+func (s *MemoryStore) Get(id string) (Person, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	person, ok := s.people[id]
+	if !ok {
+		return Person{}, ErrPersonNotFound
+	}
+	return clonePerson(person), nil
+}
+
+func (s *MemoryStore) Create(person Person) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.create(person)
+}
+
+func (s *MemoryStore) create(person Person) error {
+	if _, ok := s.people[person.ID]; ok {
+		return ErrPersonExists
+	}
+	s.people[person.ID] = clonePerson(person)
+	s.order = append(s.order, person.ID)
+	return nil
+}
+
+func (s *MemoryStore) Update(person Person) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.update(person)
+}
+
+func (s *MemoryStore) update(person Person) error {
+	if _, ok := s.people[person.ID]; !ok {
+		return ErrPersonNotFound
+	}
+	s.people[person.ID] = clonePerson(person)
+	return nil
+}
+
+func (s *MemoryStore) Modify(id string, change func(Person) (Person, error)) (Person, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	person, err := s.modified(id, change)
+	if err != nil {
+		return person, err
+	}
+	return person, s.update(person)
+}
+
+// modified runs change on a copy of the record under id, the result keeps the ID
+func (s *MemoryStore) modified(id string, change func(Person) (Person, error)) (Person, error) {
+	existing, ok := s.people[id]
+	if !ok {
+		return Person{}, ErrPersonNotFound
+	}
+	person, err := change(clonePerson(existing))
+	person.ID = id
+	return person, err
+}
+
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.delete(id)
+}
+
+func (s *MemoryStore) delete(id string) error {
+	if _, ok := s.people[id]; !ok {
+		return ErrPersonNotFound
+	}
+	delete(s.people, id)
+	for i, existing := range s.order {
+		if existing == id {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// FileStore is a MemoryStore that survives restarts. Every change is appended
+// to a journal and synced before it is applied; on open the snapshot is loaded,
+// the journal replayed on top, and both folded into a fresh snapshot. The
+// journal is also folded in once it grows past COMPACT_AFTER entries.
+type FileStore struct {
+	mem     *MemoryStore
+	dir     string
+	journal *os.File
+	entries int
+}
+
+const PEOPLE_SNAPSHOT = "people.json"
+const PEOPLE_JOURNAL = "people.journal"
+const COMPACT_AFTER = 1000
+
+type journalEntry struct {
+	Op     string  `json:"op"`
+	Person *Person `json:"person,omitempty"`
+	ID     string  `json:"id,omitempty"`
+}
+
+func OpenFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &FileStore{mem: NewMemoryStore(), dir: dir}
+
+	snapshot, err := ioutil.ReadFile(filepath.Join(dir, PEOPLE_SNAPSHOT))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(snapshot) > 0 {
+		var people []Person
+		if err := json.Unmarshal(snapshot, &people); err != nil {
+			return nil, fmt.Errorf("%s: %v", PEOPLE_SNAPSHOT, err)
+		}
+		for _, person := range people {
+			if err := s.mem.create(person); err != nil {
+				return nil, fmt.Errorf("%s: %s: %v", PEOPLE_SNAPSHOT, person.ID, err)
+			}
+		}
+	}
+	if err := s.replay(); err != nil {
+		return nil, err
+	}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// replay applies the journal. A last line without its newline was torn by a crash
+// mid-write, before the change was applied, and is dropped. Any other line that
+// can't be read or applied is an error, and the journal is left as it is.
+func (s *FileStore) replay() error {
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, PEOPLE_JOURNAL))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	lines := bytes.Split(data, []byte("\n"))
+	if torn := lines[len(lines)-1]; len(torn) > 0 {
+		log.Println(PEOPLE_JOURNAL, "dropping the torn last line:", string(torn))
+	}
+	for i, line := range lines[:len(lines)-1] {
+		var entry journalEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return fmt.Errorf("%s line %d: %v", PEOPLE_JOURNAL, i+1, err)
+		}
+		if err := s.apply(entry); err != nil {
+			return fmt.Errorf("%s line %d: %v", PEOPLE_JOURNAL, i+1, err)
+		}
+	}
+	return nil
+}
+
+func (s *FileStore) apply(entry journalEntry) error {
+	switch entry.Op {
+	case "create", "update":
+		if entry.Person == nil {
+			return fmt.Errorf("%s entry without a person", entry.Op)
+		}
+		if entry.Op == "create" {
+			return s.mem.create(*entry.Person)
+		}
+		return s.mem.update(*entry.Person)
+	case "delete":
+		return s.mem.delete(entry.ID)
+	}
+	return fmt.Errorf("unknown journal op %q", entry.Op)
+}
+
+// compact writes the snapshot next to the old one, renames it over, then starts an
+// empty journal. Callers hold the memory store's lock, or have the store to themselves.
+func (s *FileStore) compact() error {
+	data, err := json.MarshalIndent(s.mem.list(), "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.dir, PEOPLE_SNAPSHOT)
+	if err := fileutil.WriteFileAtomic(path, data); err != nil {
+		return err
+	}
+	if s.journal != nil {
+		s.journal.Close()
+	}
+	s.journal, err = os.OpenFile(filepath.Join(s.dir, PEOPLE_JOURNAL), os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0644)
+	s.entries = 0
+	return err
+}
+
+// write checks entry against the current records, journals it, then applies it
+func (s *FileStore) write(entry journalEntry, check func() error) error {
+	s.mem.mu.Lock()
+	defer s.mem.mu.Unlock()
+	if s.journal == nil {
+		return errors.New("store closed")
+	}
+	if err := check(); err != nil {
+		return err
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := s.journal.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := s.journal.Sync(); err != nil {
+		return err
+	}
+	if err := s.apply(entry); err != nil {
+		return err
+	}
+	if s.entries++; s.entries >= COMPACT_AFTER {
+		if err := s.compact(); err != nil {
+			log.Println("compacting people store:", err)
+		}
+	}
+	return nil
+}
+
+func (s *FileStore) List() ([]Person, error) {
+	return s.mem.List()
+}
+
+func (s *FileStore) Get(id string) (Person, error) {
+	return s.mem.Get(id)
+}
+
+func (s *FileStore) Create(person Person) error {
+	return s.write(journalEntry{Op: "create", Person: &person}, func() error {
+		if _, ok := s.mem.people[person.ID]; ok {
+			return ErrPersonExists
+		}
+		return nil
+	})
+}
+
+func (s *FileStore) Update(person Person) error {
+	return s.write(journalEntry{Op: "update", Person: &person}, func() error {
+		if _, ok := s.mem.people[person.ID]; !ok {
+			return ErrPersonNotFound
+		}
+		return nil
+	})
+}
+
+// Modify journals the changed record as an update. The check runs under the lock
+// and fills in the entry's person before write marshals it.
+func (s *FileStore) Modify(id string, change func(Person) (Person, error)) (Person, error) {
+	var person Person
+	err := s.write(journalEntry{Op: "update", Person: &person}, func() (err error) {
+		person, err = s.mem.modified(id, change)
+		return err
+	})
+	return person, err
+}
+
+func (s *FileStore) Delete(id string) error {
+	return s.write(journalEntry{Op: "delete", ID: id}, func() error {
+		if _, ok := s.mem.people[id]; !ok {
+			return ErrPersonNotFound
+		}
+		return nil
+	})
+}
+
+func (s *FileStore) Close() error {
+	s.mem.mu.Lock()
+	defer s.mem.mu.Unlock()
+	if s.journal == nil {
+		return nil
+	}
+	err := s.journal.Close()
+	s.journal = nil
+	return err
+}
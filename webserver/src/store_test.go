@@ -0,0 +1,204 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func tempStoreDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "people")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func openTestStore(t *testing.T, dir string) *FileStore {
+	s, err := OpenFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func listPeople(t *testing.T, s PersonStore) []Person {
+	people, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return people
+}
+
+// writeJournal puts a journal in dir as if the server had crashed before compacting it.
+func writeJournal(t *testing.T, dir string, lines string) {
+	if err := ioutil.WriteFile(filepath.Join(dir, PEOPLE_JOURNAL), []byte(lines), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileStoreRoundTrip(t *testing.T) {
+	dir := tempStoreDir(t)
+	defer os.RemoveAll(dir)
+	s := openTestStore(t, dir)
+	ada := Person{ID: "1", Firstname: "Ada", Address: &Address{City: "London"}}
+	for _, err := range []error{
+		s.Create(ada),
+		s.Create(Person{ID: "2", Firstname: "Alan"}),
+		s.Create(Person{ID: "3", Firstname: "Grace"}),
+		s.Update(Person{ID: "2", Firstname: "Alan", Lastname: "Turing"}),
+		s.Delete("3"),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Create(ada); err != ErrPersonExists {
+		t.Errorf("creating a taken ID: err = %v, want ErrPersonExists", err)
+	}
+	if err := s.Update(Person{ID: "9"}); err != ErrPersonNotFound {
+		t.Errorf("updating an unknown ID: err = %v, want ErrPersonNotFound", err)
+	}
+	want := listPeople(t, s)
+	s.Close()
+
+	reopened := openTestStore(t, dir)
+	defer reopened.Close()
+	if got := listPeople(t, reopened); !reflect.DeepEqual(got, want) {
+		t.Errorf("reopened store has %+v, want %+v", got, want)
+	}
+}
+
+func TestFileStoreReplaysJournal(t *testing.T) {
+	dir := tempStoreDir(t)
+	defer os.RemoveAll(dir)
+	writeJournal(t, dir, `{"op":"create","person":{"id":"1","firstname":"Ada"}}
+{"op":"create","person":{"id":"2","firstname":"Alan"}}
+{"op":"update","person":{"id":"1","firstname":"Ada","lastname":"Lovelace"}}
+{"op":"delete","id":"2"}
+`)
+	s := openTestStore(t, dir)
+	defer s.Close()
+	want := []Person{{ID: "1", Firstname: "Ada", Lastname: "Lovelace"}}
+	if got := listPeople(t, s); !reflect.DeepEqual(got, want) {
+		t.Errorf("replayed %+v, want %+v", got, want)
+	}
+}
+
+func TestFileStoreDropsTornTail(t *testing.T) {
+	dir := tempStoreDir(t)
+	defer os.RemoveAll(dir)
+	writeJournal(t, dir, `{"op":"create","person":{"id":"1","firstname":"Ada"}}
+{"op":"create","person":{"id":"2","first`)
+	s := openTestStore(t, dir)
+	defer s.Close()
+	want := []Person{{ID: "1", Firstname: "Ada"}}
+	if got := listPeople(t, s); !reflect.DeepEqual(got, want) {
+		t.Errorf("replayed %+v, want %+v", got, want)
+	}
+}
+
+func TestFileStoreRefusesCorruptJournal(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		journal string
+		err     string
+	}{
+		{"unreadable line", "{\"op\":\"create\",\"person\":{\"id\":\"1\"}}\nnot json\n{\"op\":\"delete\",\"id\":\"1\"}\n", "line 2"},
+		{"create without person", "{\"op\":\"create\",\"id\":\"1\"}\n", "create entry without a person"},
+		{"update without person", "{\"op\":\"update\"}\n", "update entry without a person"},
+		{"delete unknown", "{\"op\":\"delete\",\"id\":\"1\"}\n", ErrPersonNotFound.Error()},
+		{"unknown op", "{\"op\":\"rename\"}\n", "unknown journal op"},
+	} {
+		dir := tempStoreDir(t)
+		writeJournal(t, dir, c.journal)
+		s, err := OpenFileStore(dir)
+		if err == nil {
+			s.Close()
+			t.Errorf("%s: opened", c.name)
+		} else if !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: err = %v, want %q", c.name, err, c.err)
+		}
+		// the journal is kept for whoever repairs it
+		if journal, _ := ioutil.ReadFile(filepath.Join(dir, PEOPLE_JOURNAL)); string(journal) != c.journal {
+			t.Errorf("%s: journal changed to %q", c.name, journal)
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestFileStoreCompacts(t *testing.T) {
+	dir := tempStoreDir(t)
+	defer os.RemoveAll(dir)
+	s := openTestStore(t, dir)
+	defer s.Close()
+	journal := filepath.Join(dir, PEOPLE_JOURNAL)
+	if err := s.Create(Person{ID: "1", Firstname: "Ada"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < COMPACT_AFTER; i++ {
+		if err := s.Update(Person{ID: "1", Firstname: "Ada"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	info, err := os.Stat(journal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 0 {
+		t.Errorf("journal has %d bytes after %d entries, want it emptied", info.Size(), COMPACT_AFTER)
+	}
+	snapshot, err := ioutil.ReadFile(filepath.Join(dir, PEOPLE_SNAPSHOT))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(snapshot), `"Ada"`) {
+		t.Errorf("snapshot %s does not have the compacted person", snapshot)
+	}
+}
+
+func TestStoresModifyWithoutLosingChanges(t *testing.T) {
+	const changes = 50
+	dir := tempStoreDir(t)
+	defer os.RemoveAll(dir)
+	fileStore := openTestStore(t, dir)
+	defer fileStore.Close()
+	for name, s := range map[string]PersonStore{"memory": NewMemoryStore(), "file": fileStore} {
+		if err := s.Create(Person{ID: "1", Firstname: "Ada"}); err != nil {
+			t.Fatal(err)
+		}
+		var wg sync.WaitGroup
+		for i := 0; i < changes; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := s.Modify("1", func(person Person) (Person, error) {
+					person.Lastname += "x"
+					return person, nil
+				})
+				if err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+		failed := errors.New("no")
+		if _, err := s.Modify("1", func(person Person) (Person, error) {
+			person.Lastname = ""
+			return person, failed
+		}); err != failed {
+			t.Errorf("%s: err = %v, want change's error", name, err)
+		}
+		if _, err := s.Modify("9", func(person Person) (Person, error) { return person, nil }); err != ErrPersonNotFound {
+			t.Errorf("%s: modifying an unknown ID: err = %v, want ErrPersonNotFound", name, err)
+		}
+		if person, _ := s.Get("1"); person.Lastname != strings.Repeat("x", changes) {
+			t.Errorf("%s: lastname %q after %d concurrent changes", name, person.Lastname, changes)
+		}
+	}
+}